@@ -0,0 +1,57 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"fmt"
+	"os"
+
+	"golang.org/x/oauth2"
+)
+
+// Config is the Auth0 application the users log in through, set up by Initialize
+var Config *oauth2.Config
+
+var (
+	cookieKey     []byte // Signs the cookies the app sets
+	encryptionKey []byte // Encrypts tokens kept in sessions
+)
+
+// Initialize sets up the Auth0 application from the AUTH0_* variables, and
+// the keys for cookies and sessions from COOKIE_SECRET. Without a secret a
+// random one is used, so cookies and sessions stop working when the process
+// exits; set it when running several instances. It should be called during
+// application startup.
+func Initialize() error {
+	domain := os.Getenv("AUTH0_DOMAIN")
+	Config = &oauth2.Config{
+		RedirectURL:  os.Getenv("AUTH0_CALLBACK_URL"),
+		ClientID:     os.Getenv("AUTH0_CLIENT_ID"),
+		ClientSecret: os.Getenv("AUTH0_CLIENT_SECRET"),
+		Scopes:       []string{"openid", "profile", "email", "offline_access"}, // offline_access for a refresh token
+		Endpoint: oauth2.Endpoint{
+			AuthURL:  fmt.Sprintf("https://%s/authorize", domain),
+			TokenURL: fmt.Sprintf("https://%s/oauth/token", domain),
+		},
+	}
+
+	secret := []byte(os.Getenv("COOKIE_SECRET"))
+	if len(secret) == 0 {
+		secret = make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			return fmt.Errorf("failed to generate cookie secret: %w", err)
+		}
+	}
+	cookieKey = deriveKey(secret, "cookie signing")
+	encryptionKey = deriveKey(secret, "session encryption")
+	return nil
+}
+
+// deriveKey makes a key for one purpose from the secret, so no two uses
+// share a key
+func deriveKey(secret []byte, purpose string) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(purpose))
+	return mac.Sum(nil)
+}
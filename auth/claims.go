@@ -1,9 +1,27 @@
 package auth
 
 import (
+	"errors"
+
 	"github.com/golang-jwt/jwt/v5"
 )
 
+// CustomClaims are the claims of an Auth0 access token. The profile claims
+// are only there when an Auth0 action adds them to the API's tokens.
 type CustomClaims struct {
 	jwt.RegisteredClaims
+	Email         string `json:"email,omitempty"`
+	Name          string `json:"name,omitempty"`
+	Picture       string `json:"picture,omitempty"`
+	EmailVerified bool   `json:"email_verified,omitempty"`
+	Scope         string `json:"scope,omitempty"`
+}
+
+// Validate checks what the registered claims' validation doesn't. The
+// parser calls it after checking them.
+func (c *CustomClaims) Validate() error {
+	if c.Subject == "" {
+		return errors.New("token has no subject")
+	}
+	return nil
 }
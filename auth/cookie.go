@@ -0,0 +1,50 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+)
+
+// ErrInvalidCookie is returned by Open for a cookie that wasn't sealed with
+// the current key or has been tampered with
+var ErrInvalidCookie = errors.New("invalid cookie")
+
+// Seal encodes v as JSON and signs it, for a cookie value. The value is
+// readable by the client, so it mustn't hold secrets.
+func Seal(v interface{}) (string, error) {
+	if cookieKey == nil {
+		return "", errors.New("cookie key is not initialized")
+	}
+	payload, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	return encoded + "." + cookieSignature(encoded), nil
+}
+
+// Open checks a value from Seal and decodes it into v
+func Open(value string, v interface{}) error {
+	if cookieKey == nil {
+		return errors.New("cookie key is not initialized")
+	}
+	encoded, signature, ok := strings.Cut(value, ".")
+	if !ok || !hmac.Equal([]byte(signature), []byte(cookieSignature(encoded))) {
+		return ErrInvalidCookie
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return ErrInvalidCookie
+	}
+	return json.Unmarshal(payload, v)
+}
+
+func cookieSignature(encoded string) string {
+	mac := hmac.New(sha256.New, cookieKey)
+	mac.Write([]byte(encoded))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
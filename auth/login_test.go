@@ -0,0 +1,87 @@
+package auth
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSealOpen(t *testing.T) {
+	cookieKey = []byte("test key")
+	login, err := NewLoginState("/stories", time.Minute)
+	if err != nil {
+		t.Fatalf("Failed to start login: %v", err)
+	}
+	value, err := Seal(login)
+	if err != nil {
+		t.Fatalf("Failed to seal: %v", err)
+	}
+
+	var opened LoginState
+	if err := Open(value, &opened); err != nil {
+		t.Fatalf("Failed to open: %v", err)
+	}
+	if opened != *login {
+		t.Errorf("Expected %+v, got %+v", *login, opened)
+	}
+	if err := opened.Check(login.State); err != nil {
+		t.Errorf("Expected the state to match, got %v", err)
+	}
+	if err := opened.Check("random"); err == nil {
+		t.Error("Expected another state to be rejected")
+	}
+
+	if err := Open("x"+value, &opened); err != ErrInvalidCookie {
+		t.Errorf("Expected a tampered cookie to be rejected, got %v", err)
+	}
+	cookieKey = []byte("another key")
+	if err := Open(value, &opened); err != ErrInvalidCookie {
+		t.Errorf("Expected a cookie sealed with another key to be rejected, got %v", err)
+	}
+
+	expired := LoginState{State: "abc", Expires: time.Now().Add(-time.Second).Unix()}
+	if err := expired.Check("abc"); err == nil {
+		t.Error("Expected an expired login to be rejected")
+	}
+}
+
+func TestSafeReturnTo(t *testing.T) {
+	allowed := []string{"https://irvyn.dev/", " https://app.irvyn.dev"}
+	tests := []struct {
+		raw, want string
+	}{
+		{"", DefaultReturnTo},
+		{"/stories?id=3", "/stories?id=3"},
+		{"stories", DefaultReturnTo},
+		{"//evil.com", DefaultReturnTo},
+		{"/\\evil.com", DefaultReturnTo},
+		{"https://irvyn.dev/stories", "https://irvyn.dev/stories"},
+		{"https://app.irvyn.dev", "https://app.irvyn.dev"},
+		{"https://irvyn.dev.evil.com/", DefaultReturnTo},
+		{"http://irvyn.dev/", DefaultReturnTo},
+		{"https://user@irvyn.dev/", DefaultReturnTo},
+		{"javascript:alert(1)", DefaultReturnTo},
+	}
+	for _, tt := range tests {
+		if got := SafeReturnTo(tt.raw, allowed); got != tt.want {
+			t.Errorf("SafeReturnTo(%q) = %q, want %q", tt.raw, got, tt.want)
+		}
+	}
+}
+
+func TestEncrypt(t *testing.T) {
+	if err := Initialize(); err != nil {
+		t.Fatalf("Failed to initialize: %v", err)
+	}
+	encrypted, err := Encrypt("refresh-token")
+	if err != nil {
+		t.Fatalf("Failed to encrypt: %v", err)
+	}
+	if decrypted, err := Decrypt(encrypted); err != nil || decrypted != "refresh-token" {
+		t.Errorf("Expected the token back, got %q, %v", decrypted, err)
+	}
+	tampered := []byte(encrypted)
+	tampered[len(tampered)/2] ^= 1
+	if _, err := Decrypt(string(tampered)); err == nil {
+		t.Error("Expected tampered ciphertext to be rejected")
+	}
+}
@@ -0,0 +1,46 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"golang.org/x/oauth2"
+)
+
+// Refresh gets a new access token with a refresh token. Auth0 may rotate
+// the refresh token, so the returned one replaces it.
+func Refresh(ctx context.Context, refreshToken string) (*oauth2.Token, error) {
+	return Config.TokenSource(ctx, &oauth2.Token{RefreshToken: refreshToken}).Token()
+}
+
+// Revoke revokes a refresh token, so it can't get any more access tokens
+func Revoke(ctx context.Context, refreshToken string) error {
+	body, err := json.Marshal(map[string]string{
+		"client_id":     Config.ClientID,
+		"client_secret": Config.ClientSecret,
+		"token":         refreshToken,
+	})
+	if err != nil {
+		return err
+	}
+	url := strings.TrimSuffix(Config.Endpoint.TokenURL, "/token") + "/revoke"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("revoking refresh token: %s", resp.Status)
+	}
+	return nil
+}
@@ -38,10 +38,93 @@ func Connect() error {
 		return err
 	}
 
+	if err := migrateObjectURLsToKeys(); err != nil {
+		return err
+	}
+
 	// Automatically migrate your schema
-	if err := DB.AutoMigrate(&models.User{}, &models.Story{}, &models.Segment{}); err != nil {
+	if err := DB.AutoMigrate(&models.User{}, &models.Story{}, &models.Segment{}, &models.AmbientTrack{}, &models.Session{}); err != nil {
 		return err
 	}
 
+	if err := migrateKeysToProfiles(); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// migrateObjectURLsToKeys renames the video_url and image_url columns, which
+// held public R2 URLs. Objects are private now, so only their keys are stored.
+func migrateObjectURLsToKeys() error {
+	renames := []struct {
+		model    interface{}
+		from, to string
+	}{
+		{&models.Story{}, "video_url", "video_key"},
+		{&models.Segment{}, "image_url", "image_key"},
+	}
+
+	migrator := DB.Migrator()
+	for _, r := range renames {
+		if !migrator.HasTable(r.model) || !migrator.HasColumn(r.model, r.from) || migrator.HasColumn(r.model, r.to) {
+			continue
+		}
+		log.Printf("Renaming column %s to %s", r.from, r.to)
+		if err := migrator.RenameColumn(r.model, r.from, r.to); err != nil {
+			return err
+		}
+
+		// Strip everything before the key, e.g. https://<bucket url>/videos/story_1_video.mp4
+		stmt := &gorm.Statement{DB: DB}
+		if err := stmt.Parse(r.model); err != nil {
+			return err
+		}
+		if err := DB.Exec(
+			fmt.Sprintf("UPDATE %s SET %s = substring(%s from '(?:videos|images)/.*$') WHERE %s LIKE '%%://%%'",
+				stmt.Schema.Table, r.to, r.to, r.to),
+		).Error; err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// migrateKeysToProfiles moves the single image and video keys of stories made
+// before output profiles into the per-aspect and per-profile maps. Those were
+// all rendered in the landscape profile. The image_key column, renamed from
+// image_url, is dropped once copied, video_key is still the main video.
+func migrateKeysToProfiles() error {
+	migrations := []struct {
+		table, from, to, name string
+		drop                  bool
+	}{
+		{"segments", "image_key", "image_keys", "16:9", true},
+		{"stories", "video_key", "video_keys", "landscape", false},
+	}
+
+	for _, m := range migrations {
+		if !DB.Migrator().HasColumn(m.table, m.from) {
+			continue
+		}
+		err := DB.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Exec(
+				fmt.Sprintf("UPDATE %s SET %s = jsonb_build_object(?::text, %s) WHERE %s <> '' AND %s IS NULL",
+					m.table, m.to, m.from, m.from, m.to),
+				m.name,
+			).Error; err != nil {
+				return err
+			}
+			if m.drop {
+				log.Printf("Dropping column %s.%s", m.table, m.from)
+				return tx.Migrator().DropColumn(m.table, m.from)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
 	return nil
 }
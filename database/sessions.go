@@ -0,0 +1,60 @@
+package database
+
+import (
+	"log"
+	"time"
+
+	"github.com/1rvyn/halloween-story-generator/models"
+	"gorm.io/gorm/clause"
+)
+
+// SessionStorage keeps login sessions in the database, so they survive
+// restarts and are shared between instances. It implements fiber.Storage.
+type SessionStorage struct{}
+
+// NewSessionStorage returns the session storage and starts deleting expired
+// sessions in the background
+func NewSessionStorage() *SessionStorage {
+	go func() {
+		for range time.Tick(time.Hour) {
+			err := DB.Where("expires_at > ? AND expires_at < ?", time.Time{}, time.Now()).Delete(&models.Session{}).Error
+			if err != nil {
+				log.Printf("Failed to delete expired sessions: %v", err)
+			}
+		}
+	}()
+	return &SessionStorage{}
+}
+
+// Get returns a session's data, nil if there is no such session or it expired
+func (*SessionStorage) Get(key string) ([]byte, error) {
+	var session models.Session
+	result := DB.Where("id = ?", key).Limit(1).Find(&session)
+	if result.Error != nil || result.RowsAffected == 0 {
+		return nil, result.Error
+	}
+	if !session.ExpiresAt.IsZero() && session.ExpiresAt.Before(time.Now()) {
+		return nil, nil
+	}
+	return session.Data, nil
+}
+
+func (*SessionStorage) Set(key string, val []byte, exp time.Duration) error {
+	session := models.Session{ID: key, Data: val}
+	if exp > 0 {
+		session.ExpiresAt = time.Now().Add(exp)
+	}
+	return DB.Clauses(clause.OnConflict{UpdateAll: true}).Create(&session).Error
+}
+
+func (*SessionStorage) Delete(key string) error {
+	return DB.Delete(&models.Session{}, "id = ?", key).Error
+}
+
+func (*SessionStorage) Reset() error {
+	return DB.Where("1 = 1").Delete(&models.Session{}).Error
+}
+
+func (*SessionStorage) Close() error {
+	return nil
+}
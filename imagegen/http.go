@@ -0,0 +1,100 @@
+package imagegen
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// HTTP generates images with a self-hosted text-to-image server. It posts
+//
+//	{"prompt": ..., "negative_prompt": ..., "seed": ..., "width": ..., "height": ..., "model": ...}
+//
+// and accepts either raw image bytes back, or a JSON body holding base64
+// images in an "images" array, as the Stable Diffusion web UI's
+// /sdapi/v1/txt2img endpoint returns.
+type HTTP struct {
+	URL    string
+	Model  string
+	Client *http.Client
+}
+
+// NewHTTP returns a backend for the text-to-image server at url
+func NewHTTP(url, model string) *HTTP {
+	return &HTTP{
+		URL:    url,
+		Model:  model,
+		Client: &http.Client{},
+	}
+}
+
+func (h *HTTP) Generate(ctx context.Context, req Request) (*Image, error) {
+	width, height := Dimensions(req.AspectRatio)
+	payload := map[string]interface{}{
+		"prompt": req.Prompt,
+		"width":  width,
+		"height": height,
+	}
+	if req.NegativePrompt != "" {
+		payload["negative_prompt"] = req.NegativePrompt
+	}
+	if req.Seed != 0 {
+		payload["seed"] = req.Seed
+	}
+	if h.Model != "" {
+		payload["model"] = h.Model
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("marshalling image request: %w", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", h.URL, bytes.NewBuffer(body))
+	if err != nil {
+		return nil, fmt.Errorf("creating image request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	resp, err := h.Client.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("making image request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("reading image response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("image server returned status %d: %s", resp.StatusCode, string(respBody))
+	}
+
+	contentType := resp.Header.Get("Content-Type")
+	if strings.HasPrefix(contentType, "image/") {
+		return &Image{Data: respBody, ContentType: contentType}, nil
+	}
+
+	var jsonResp struct {
+		Images []string `json:"images"`
+	}
+	if err := json.Unmarshal(respBody, &jsonResp); err != nil {
+		return nil, fmt.Errorf("unmarshalling image response: %w", err)
+	}
+	if len(jsonResp.Images) == 0 {
+		return nil, errors.New("no images in image server response")
+	}
+
+	data, err := base64.StdEncoding.DecodeString(jsonResp.Images[0])
+	if err != nil {
+		return nil, fmt.Errorf("decoding image: %w", err)
+	}
+	return &Image{Data: data, ContentType: http.DetectContentType(data)}, nil
+}
@@ -0,0 +1,77 @@
+package imagegen
+
+import (
+	"context"
+	"fmt"
+	"os"
+)
+
+// Request describes the picture for one segment
+type Request struct {
+	Prompt         string
+	NegativePrompt string // What to keep out of the picture, for backends that support it
+	AspectRatio    string // e.g. "16:9"
+	Seed           int64  // Reused to keep a story's images alike, on backends that take one. 0 for random
+}
+
+// Image is a generated picture, in whatever format the backend produces
+type Image struct {
+	Data        []byte
+	ContentType string // e.g. "image/webp"
+}
+
+// ImageGenerator turns a text prompt into a picture
+type ImageGenerator interface {
+	Generate(ctx context.Context, req Request) (*Image, error)
+}
+
+// New returns the named backend, configured from the environment.
+// An empty model uses the backend's default.
+//
+//	replicate   (default) Replicate's hosted models, needs REPLICATE_API_TOKEN;
+//	            models besides the default must be listed in REPLICATE_MODELS
+//	http        any text-to-image server at IMAGEGEN_HTTP_URL, e.g. a local Stable Diffusion
+//	placeholder draws the prompt onto a dark card, for tests and offline runs
+func New(backend, model string) (ImageGenerator, error) {
+	switch backend {
+	case "", "replicate":
+		if err := ValidateReplicateModel(model); err != nil {
+			return nil, err
+		}
+		return NewReplicate(os.Getenv("REPLICATE_API_TOKEN"), model), nil
+	case "http":
+		url := os.Getenv("IMAGEGEN_HTTP_URL")
+		if url == "" {
+			return nil, fmt.Errorf("IMAGEGEN_HTTP_URL must be set for the http image backend")
+		}
+		return NewHTTP(url, model), nil
+	case "placeholder":
+		return NewPlaceholder(), nil
+	default:
+		return nil, fmt.Errorf("unknown image backend %q", backend)
+	}
+}
+
+// Dimensions returns the pixel size used for an aspect ratio
+func Dimensions(aspectRatio string) (int, int) {
+	switch aspectRatio {
+	case "9:16":
+		return 768, 1344
+	case "1:1":
+		return 1024, 1024
+	default:
+		return 1344, 768
+	}
+}
+
+// Extension returns the file extension for an image content type
+func Extension(contentType string) string {
+	switch contentType {
+	case "image/png":
+		return ".png"
+	case "image/jpeg":
+		return ".jpg"
+	default:
+		return ".webp"
+	}
+}
@@ -0,0 +1,127 @@
+package imagegen
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestPlaceholderGenerate(t *testing.T) {
+	req := Request{Prompt: "The door creaked open on its own.", AspectRatio: "16:9"}
+
+	image, err := NewPlaceholder().Generate(context.Background(), req)
+	if err != nil {
+		t.Fatalf("Expected success, got error: %v", err)
+	}
+	if image.ContentType != "image/png" {
+		t.Errorf("Expected image/png, got %s", image.ContentType)
+	}
+
+	decoded, err := png.Decode(bytes.NewReader(image.Data))
+	if err != nil {
+		t.Fatalf("Expected a valid PNG, got error: %v", err)
+	}
+	if b := decoded.Bounds(); b.Dx() != 1344 || b.Dy() != 768 {
+		t.Errorf("Expected 1344x768, got %dx%d", b.Dx(), b.Dy())
+	}
+
+	again, _ := NewPlaceholder().Generate(context.Background(), req)
+	if !bytes.Equal(image.Data, again.Data) {
+		t.Error("Expected the same prompt to produce the same card")
+	}
+}
+
+func TestHTTPGenerateBase64Images(t *testing.T) {
+	card, _ := NewPlaceholder().Generate(context.Background(), Request{Prompt: "test", AspectRatio: "1:1"})
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			t.Errorf("Failed to decode request: %v", err)
+		}
+		if payload["prompt"] != "a haunted house" || payload["negative_prompt"] != "text" || payload["width"] != float64(1024) || payload["model"] != "sd-test" {
+			t.Errorf("Unexpected payload: %v", payload)
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"images": []string{base64.StdEncoding.EncodeToString(card.Data)},
+		})
+	}))
+	defer server.Close()
+
+	image, err := NewHTTP(server.URL, "sd-test").Generate(context.Background(), Request{Prompt: "a haunted house", NegativePrompt: "text", AspectRatio: "1:1"})
+	if err != nil {
+		t.Fatalf("Expected success, got error: %v", err)
+	}
+	if !bytes.Equal(image.Data, card.Data) || image.ContentType != "image/png" {
+		t.Errorf("Unexpected image: %s, %d bytes", image.ContentType, len(image.Data))
+	}
+}
+
+func TestNewUnknownBackend(t *testing.T) {
+	if _, err := New("dall-e-9000", ""); err == nil {
+		t.Error("Expected error for unknown backend, got nil")
+	}
+}
+
+func TestValidateReplicateModel(t *testing.T) {
+	t.Setenv("REPLICATE_MODELS", "black-forest-labs/flux-dev, stability-ai/sdxl")
+	tests := []struct {
+		model string
+		valid bool
+	}{
+		{"", true},
+		{"black-forest-labs/flux-schnell", true},
+		{"black-forest-labs/flux-dev", true},
+		{"stability-ai/sdxl", true},
+		{"black-forest-labs/flux-pro", false},
+		{"../../account", false},
+		{"black-forest-labs/flux-dev/../../x", false},
+		{"black-forest-labs", false},
+	}
+	for _, tt := range tests {
+		if err := ValidateReplicateModel(tt.model); (err == nil) != tt.valid {
+			t.Errorf("ValidateReplicateModel(%q) = %v, want valid %v", tt.model, err, tt.valid)
+		}
+	}
+	if _, err := New("replicate", "../../account"); err == nil {
+		t.Error("Expected New to reject a model that isn't allowed")
+	}
+}
+
+func TestReplicateGenerateContentType(t *testing.T) {
+	card, err := NewPlaceholder().Generate(context.Background(), Request{Prompt: "A dark hallway", AspectRatio: "1:1"})
+	if err != nil {
+		t.Fatalf("Failed to draw placeholder: %v", err)
+	}
+
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/models/black-forest-labs/flux-schnell/predictions":
+			w.WriteHeader(http.StatusCreated)
+			fmt.Fprintf(w, `{"status": "succeeded", "output": [%q], "urls": {"get": %q}}`, server.URL+"/image", server.URL+"/poll")
+		case "/image":
+			w.Header().Set("Content-Type", "application/octet-stream")
+			w.Write(card.Data)
+		default:
+			t.Errorf("Unexpected request to %s", r.URL.Path)
+		}
+	}))
+	defer server.Close()
+
+	r := NewReplicate("token", "")
+	r.BaseURL = server.URL
+	image, err := r.Generate(context.Background(), Request{Prompt: "A dark hallway", AspectRatio: "1:1"})
+	if err != nil {
+		t.Fatalf("Expected success, got error: %v", err)
+	}
+	if image.ContentType != "image/png" {
+		t.Errorf("Expected the PNG to be recognised, got %s", image.ContentType)
+	}
+}
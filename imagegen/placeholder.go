@@ -0,0 +1,97 @@
+package imagegen
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/color"
+	"image/png"
+	"strings"
+
+	"golang.org/x/image/draw"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+)
+
+var (
+	cardTop    = color.RGBA{R: 0x24, G: 0x10, B: 0x2e, A: 0xff}
+	cardBottom = color.RGBA{R: 0x05, G: 0x03, B: 0x08, A: 0xff}
+	cardText   = color.RGBA{R: 0xe8, G: 0xa2, B: 0x5a, A: 0xff}
+)
+
+// Placeholder draws the prompt onto a dark card instead of calling a model.
+// The output only depends on the request, so it's safe to use in tests.
+type Placeholder struct {
+	Scale int // The bitmap font is tiny, so the card is drawn small and scaled up by this much
+}
+
+// NewPlaceholder returns a placeholder backend
+func NewPlaceholder() *Placeholder {
+	return &Placeholder{Scale: 3}
+}
+
+func (p *Placeholder) Generate(ctx context.Context, req Request) (*Image, error) {
+	width, height := Dimensions(req.AspectRatio)
+	small := image.NewRGBA(image.Rect(0, 0, width/p.Scale, height/p.Scale))
+	bounds := small.Bounds()
+
+	// Fade from a dark purple down to black
+	for y := 0; y < bounds.Dy(); y++ {
+		c := mix(cardTop, cardBottom, float64(y)/float64(bounds.Dy()))
+		for x := 0; x < bounds.Dx(); x++ {
+			small.SetRGBA(x, y, c)
+		}
+	}
+
+	face := basicfont.Face7x13
+	margin := bounds.Dx() / 10
+	lines := wrap(req.Prompt, face, bounds.Dx()-2*margin)
+
+	lineHeight := face.Metrics().Height.Ceil() + 2
+	y := (bounds.Dy()-len(lines)*lineHeight)/2 + face.Metrics().Ascent.Ceil()
+	drawer := &font.Drawer{Dst: small, Src: image.NewUniform(cardText), Face: face}
+	for _, line := range lines {
+		lineWidth := drawer.MeasureString(line).Ceil()
+		drawer.Dot = fixed.P((bounds.Dx()-lineWidth)/2, y)
+		drawer.DrawString(line)
+		y += lineHeight
+	}
+
+	card := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.NearestNeighbor.Scale(card, card.Bounds(), small, bounds, draw.Src, nil)
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, card); err != nil {
+		return nil, err
+	}
+	return &Image{Data: buf.Bytes(), ContentType: "image/png"}, nil
+}
+
+// wrap breaks text into lines no wider than maxWidth pixels
+func wrap(text string, face font.Face, maxWidth int) []string {
+	var lines []string
+	line := ""
+	for _, word := range strings.Fields(text) {
+		candidate := word
+		if line != "" {
+			candidate = line + " " + word
+		}
+		if line != "" && font.MeasureString(face, candidate).Ceil() > maxWidth {
+			lines = append(lines, line)
+			candidate = word
+		}
+		line = candidate
+	}
+	if line != "" {
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+func mix(a, b color.RGBA, t float64) color.RGBA {
+	lerp := func(x, y uint8) uint8 {
+		return uint8(float64(x) + (float64(y)-float64(x))*t)
+	}
+	return color.RGBA{R: lerp(a.R, b.R), G: lerp(a.G, b.G), B: lerp(a.B, b.B), A: 0xff}
+}
@@ -0,0 +1,195 @@
+package imagegen
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	replicateBaseURL      = "https://api.replicate.com/v1"
+	defaultReplicateModel = "black-forest-labs/flux-schnell"
+)
+
+// replicateModelPattern is an owner/name model reference, which is spliced
+// into the API path
+var replicateModelPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_.-]*/[a-z0-9][a-z0-9_.-]*$`)
+
+// ValidateReplicateModel checks a story's model against the models the
+// server allows, the default and those listed in REPLICATE_MODELS,
+// comma separated. Runs are billed to the server's token, so users can't
+// pick just any model.
+func ValidateReplicateModel(model string) error {
+	if model == "" || model == defaultReplicateModel {
+		return nil
+	}
+	if !replicateModelPattern.MatchString(model) {
+		return fmt.Errorf("invalid image model %q, expected owner/name", model)
+	}
+	for _, allowed := range strings.Split(os.Getenv("REPLICATE_MODELS"), ",") {
+		if strings.TrimSpace(allowed) == model {
+			return nil
+		}
+	}
+	return fmt.Errorf("image model %q is not available", model)
+}
+
+type prediction struct {
+	Output []string `json:"output"`
+	Error  string   `json:"error"`
+	Status string   `json:"status"`
+	URLs   struct {
+		Get string `json:"get"`
+	} `json:"urls"`
+}
+
+// Replicate generates images with a model hosted on Replicate
+type Replicate struct {
+	BaseURL  string
+	APIToken string
+	Model    string // owner/name, e.g. black-forest-labs/flux-schnell
+	Client   *http.Client
+}
+
+// NewReplicate returns a Replicate backend, defaulting to flux-schnell
+func NewReplicate(apiToken, model string) *Replicate {
+	if model == "" {
+		model = defaultReplicateModel
+	}
+	return &Replicate{
+		BaseURL:  replicateBaseURL,
+		APIToken: apiToken,
+		Model:    model,
+		Client:   &http.Client{},
+	}
+}
+
+func (r *Replicate) Generate(ctx context.Context, req Request) (*Image, error) {
+	// Prepare the payload for Replicate API
+	input := map[string]interface{}{
+		"prompt":         req.Prompt,
+		"num_outputs":    1,
+		"aspect_ratio":   req.AspectRatio,
+		"output_format":  "webp",
+		"output_quality": 20,
+	}
+	if req.Seed != 0 {
+		input["seed"] = req.Seed
+	}
+	// FLUX models have no negative prompt input
+	if req.NegativePrompt != "" && !strings.Contains(r.Model, "/flux") {
+		input["negative_prompt"] = req.NegativePrompt
+	}
+	replicatePayload := map[string]interface{}{"input": input}
+
+	replicateBody, err := json.Marshal(replicatePayload)
+	if err != nil {
+		return nil, fmt.Errorf("marshalling Replicate request: %w", err)
+	}
+
+	url := fmt.Sprintf("%s/models/%s/predictions", r.BaseURL, r.Model)
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(replicateBody))
+	if err != nil {
+		return nil, fmt.Errorf("creating Replicate request: %w", err)
+	}
+
+	var pred prediction
+	if err := r.do(httpReq, http.StatusCreated, &pred); err != nil {
+		return nil, err
+	}
+
+	// Use the URL from the initial response for polling
+	pollingURL := pred.URLs.Get
+	if pollingURL == "" {
+		return nil, fmt.Errorf("no polling URL provided in the initial response")
+	}
+
+	// Polling until the prediction is succeeded or failed
+	for pred.Status != "succeeded" && pred.Status != "failed" && pred.Status != "canceled" {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(1 * time.Second):
+		}
+
+		getReq, err := http.NewRequestWithContext(ctx, "GET", pollingURL, nil)
+		if err != nil {
+			return nil, fmt.Errorf("creating poll request: %w", err)
+		}
+		if err := r.do(getReq, http.StatusOK, &pred); err != nil {
+			return nil, err
+		}
+
+		log.Printf("Polling Replicate prediction: Status=%s", pred.Status)
+	}
+
+	if pred.Status != "succeeded" {
+		return nil, fmt.Errorf("replicate prediction %s: %s", pred.Status, pred.Error)
+	}
+
+	if len(pred.Output) == 0 {
+		return nil, fmt.Errorf("no output from Replicate")
+	}
+
+	// Download the image from Replicate
+	imageReq, err := http.NewRequestWithContext(ctx, "GET", pred.Output[0], nil)
+	if err != nil {
+		return nil, fmt.Errorf("creating image download request: %w", err)
+	}
+	imageResp, err := r.Client.Do(imageReq)
+	if err != nil {
+		return nil, fmt.Errorf("downloading image: %w", err)
+	}
+	defer imageResp.Body.Close()
+
+	if imageResp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("downloading image: %s", imageResp.Status)
+	}
+
+	imageData, err := io.ReadAll(imageResp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("reading image data: %w", err)
+	}
+
+	// Models don't all honour output_format, so go by what came back
+	contentType, _, _ := mime.ParseMediaType(imageResp.Header.Get("Content-Type"))
+	if !strings.HasPrefix(contentType, "image/") {
+		contentType = http.DetectContentType(imageData)
+	}
+	return &Image{Data: imageData, ContentType: contentType}, nil
+}
+
+// do sends an authenticated request and decodes the prediction in the response
+func (r *Replicate) do(req *http.Request, wantStatus int, pred *prediction) error {
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", r.APIToken))
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := r.Client.Do(req)
+	if err != nil {
+		return fmt.Errorf("making Replicate request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("reading Replicate response: %w", err)
+	}
+
+	if resp.StatusCode != wantStatus {
+		return fmt.Errorf("replicate API error: %s", string(body))
+	}
+
+	if err := json.Unmarshal(body, pred); err != nil {
+		return fmt.Errorf("unmarshalling Replicate response: %w", err)
+	}
+	return nil
+}
@@ -1,15 +1,24 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
 	"os"
+	"strconv"
 
+	"github.com/1rvyn/halloween-story-generator/auth"
 	"github.com/1rvyn/halloween-story-generator/database"
 	"github.com/1rvyn/halloween-story-generator/middleware"
+	"github.com/1rvyn/halloween-story-generator/narrator"
+	"github.com/1rvyn/halloween-story-generator/pipeline"
 	"github.com/1rvyn/halloween-story-generator/routes"
+	"github.com/1rvyn/halloween-story-generator/segmenter"
+	"github.com/1rvyn/halloween-story-generator/storage"
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/cors"
+	"github.com/gofiber/fiber/v2/middleware/session"
 	"github.com/gofiber/template/html/v2"
 	"github.com/joho/godotenv"
 )
@@ -51,28 +60,77 @@ func main() {
 	}
 
 	// Initialize JWKS
-	if err := middleware.InitializeJWKS(os.Getenv("AUTH0_DOMAIN")); err != nil {
+	if err := middleware.InitializeJWKS(auth0Domain, auth0Audience); err != nil {
 		log.Fatalf("Failed to initialize JWKS: %v", err)
 	}
 
-	// Initialize R2
-	if err := middleware.InitializeR2(); err != nil {
-		log.Fatalf("Failed to initialize R2: %v", err)
+	// Initialize the Auth0 application and cookie and session keys
+	if err := auth.Initialize(); err != nil {
+		log.Fatalf("Failed to initialize auth: %v", err)
 	}
 
+	// Keep login sessions in the database
+	middleware.SetSessionStore(session.New(session.Config{
+		Storage:        database.NewSessionStorage(),
+		Expiration:     middleware.SessionLifetime,
+		KeyLookup:      "cookie:session_id",
+		CookieSecure:   true,
+		CookieHTTPOnly: true,
+		CookieSameSite: "Lax",
+	}))
+
+	// Initialize object storage (R2, or a local directory in development)
+	if err := storage.Initialize(); err != nil {
+		log.Fatalf("Failed to initialize storage: %v", err)
+	}
+
+	// Initialize word alignment for captions
+	if err := narrator.InitializeAligner(); err != nil {
+		log.Fatalf("Failed to initialize word aligner: %v", err)
+	}
+
+	// Initialize the story segmenter
+	if err := segmenter.Initialize(); err != nil {
+		log.Fatalf("Failed to initialize segmenter: %v", err)
+	}
+
+	// Start the story workers
+	workers, _ := strconv.Atoi(os.Getenv("STORY_WORKERS"))
+	if workers == 0 {
+		workers = 2
+	}
+	if err := pipeline.Start(workers); err != nil {
+		log.Fatalf("Failed to start story workers: %v", err)
+	}
+
+	// Store the built-in ambient tracks on a fresh deploy
+	go func() {
+		if err := pipeline.SeedAmbientLibrary(context.Background()); err != nil {
+			log.Printf("Failed to seed ambient library: %v", err)
+		}
+	}()
+
 	// Create a new Fiber instance
 	app := fiber.New(fiber.Config{
-		Views: html.New("./views", ".html"),
+		Views:        html.New("./views", ".html"),
+		ErrorHandler: jsonErrorHandler,
+		BodyLimit:    25 * 1024 * 1024, // Room for ambient track uploads
 	})
 
 	// Enable CORS
 	app.Use(cors.New(cors.Config{
 		AllowOrigins:     "https://irvyn.dev",
-		AllowMethods:     "POST, GET, OPTIONS",
-		AllowHeaders:     "Content-Type",
+		AllowMethods:     "POST, GET, PUT, PATCH, DELETE, OPTIONS",
+		AllowHeaders:     "Content-Type, Authorization, X-CSRF-Token",
+		ExposeHeaders:    "X-Access-Token", // Refreshed access tokens
 		AllowCredentials: true,
 	}))
 
+	// Serve locally stored files when not using R2, to signed links only
+	if local, ok := storage.Default.(*storage.LocalStore); ok {
+		app.Get(local.BaseURL+"/*", routes.LocalFiles(local))
+	}
+
 	setupRoutes(app)
 
 	log.Println("Server starting on :8080")
@@ -87,6 +145,8 @@ func setupRoutes(app *fiber.App) {
 	app.Post("/signup", routes.Signup)
 	app.Get("/login/google", routes.LoginWithGoogle)
 	app.Get("/callback", routes.Callback)
+	app.Post("/logout", routes.Logout)           // Works with an expired token too
+	app.Get("/hls/:id/*", routes.GetHLSPlaylist) // Signed links, players can't send the auth header
 
 	// app routes (using JWT middleware)
 	protected := app.Group("/", middleware.AuthRequired())
@@ -94,9 +154,47 @@ func setupRoutes(app *fiber.App) {
 	// Protected API routes
 	api := protected.Group("/api")
 	api.Post("/story", routes.CreateStory)
+	api.Get("/story/:id/status", routes.GetStoryStatus)
+	api.Post("/story/:id/resume", routes.ResumeStory)
+	api.Get("/story/:id/video", routes.GetStoryVideo)
+	api.Get("/story/:id/subtitles", routes.GetStorySubtitles)
+	api.Post("/story/:id/render", routes.RenderStory)
+	api.Get("/story/:id/segments", routes.GetStorySegments)
+	api.Post("/story/:id/segments/reorder", routes.ReorderSegments)
+	api.Patch("/story/:id/segments/:n", routes.UpdateSegment)
+	api.Delete("/story/:id/segments/:n", routes.DeleteSegment)
+	api.Post("/story/:id/segments/:n/split", routes.SplitSegment)
+	api.Post("/story/:id/segments/:n/merge", routes.MergeSegment)
+	api.Get("/story/:id/segments/:n/image", routes.GetSegmentImage)
+	api.Post("/story/:id/segments/:n/regenerate-image", routes.RegenerateSegmentImage)
+	api.Post("/story/:id/segments/:n/regenerate-audio", routes.RegenerateSegmentAudio)
+	api.Post("/story/:id/rerender", routes.RerenderStory)
+	api.Get("/story/:id/bible", routes.GetStoryBible)
+	api.Put("/story/:id/bible", routes.UpdateStoryBible)
 	api.Get("/stories", routes.GetStories)
+	api.Get("/ambient", routes.GetAmbientTracks)
+	api.Post("/ambient", routes.UploadAmbientTrack)
 
 	// Protected web route
 	// protected.Get("/dashboard", routes.Dashboard)
 	// protected.Get("/story", routes.ViewStory)
 }
+
+// jsonErrorHandler reports errors returned from handlers in the same
+// {"error": "..."} shape the handlers use themselves
+func jsonErrorHandler(c *fiber.Ctx, err error) error {
+	code := fiber.StatusInternalServerError
+	message := "Internal Server Error"
+
+	var fiberErr *fiber.Error
+	if errors.As(err, &fiberErr) {
+		code = fiberErr.Code
+		message = fiberErr.Message
+	} else {
+		log.Printf("Unhandled error on %s %s: %v", c.Method(), c.Path(), err)
+	}
+
+	return c.Status(code).JSON(fiber.Map{
+		"error": message,
+	})
+}
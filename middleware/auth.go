@@ -3,70 +3,74 @@ package middleware
 import (
 	"context"
 	"fmt"
-	"os"
+	"log"
 	"strings"
 	"time"
 
+	"github.com/1rvyn/halloween-story-generator/auth"
 	"github.com/1rvyn/halloween-story-generator/database"
 	"github.com/1rvyn/halloween-story-generator/models"
-	"github.com/MicahParks/keyfunc"
-	"github.com/aws/aws-sdk-go-v2/config"
-	"github.com/aws/aws-sdk-go-v2/credentials"
-	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/MicahParks/keyfunc/v3"
 	"github.com/gofiber/fiber/v2"
-	"github.com/golang-jwt/jwt/v4"
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/time/rate"
 )
 
 // Global variable to store JWKS
-var jwks *keyfunc.JWKS
-
-// Global variable to store S3 client for R2
-var R2Client *s3.Client
-
-// InitializeJWKS initializes the JWKS and should be called during application startup
-func InitializeJWKS(auth0Domain string) error {
-	jwksURL := "https://" + auth0Domain + "/.well-known/jwks.json"
-	options := keyfunc.Options{
-		RefreshInterval:   time.Hour,
-		RefreshRateLimit:  time.Minute * 5,
-		RefreshTimeout:    time.Second * 10,
-		RefreshUnknownKID: true,
-	}
+var jwks keyfunc.Keyfunc
+
+// The issuer and audience access tokens must have, set with the JWKS
+var (
+	issuer   string
+	audience string
+)
+
+// allowedAlgorithms are the signing algorithms accepted, Auth0's default
+// only, so a token can't pick a weaker one
+var allowedAlgorithms = []string{"RS256"}
+
+// clockSkew is how far the expiry and not before times are stretched for
+// clocks that disagree with Auth0's
+const clockSkew = 30 * time.Second
+
+// InitializeJWKS initializes the JWKS and the issuer and audience tokens are
+// checked against, and should be called during application startup
+func InitializeJWKS(auth0Domain, auth0Audience string) error {
+	return initializeJWKS("https://"+auth0Domain+"/.well-known/jwks.json", "https://"+auth0Domain+"/", auth0Audience)
+}
+
+func initializeJWKS(jwksURL, tokenIssuer, tokenAudience string) error {
+	noErrorOnFirstRequest := false // Fail at startup if Auth0 can't be reached
 	var err error
-	jwks, err = keyfunc.Get(jwksURL, options)
+	jwks, err = keyfunc.NewDefaultOverrideCtx(context.Background(), []string{jwksURL}, keyfunc.Override{
+		RefreshInterval:           time.Hour,
+		RefreshUnknownKID:         rate.NewLimiter(rate.Every(time.Minute*5), 1),
+		HTTPTimeout:               time.Second * 10,
+		NoErrorReturnFirstHTTPReq: &noErrorOnFirstRequest,
+	})
 	if err != nil {
 		return fmt.Errorf("failed to get JWKS from Auth0: %w", err)
 	}
+	issuer, audience = tokenIssuer, tokenAudience
 	return nil
 }
 
-// InitializeR2 initializes the Cloudflare R2 client
-func InitializeR2() error {
-	accessKey := os.Getenv("AWS_ACCESS_KEY_ID")
-	secretKey := os.Getenv("AWS_SECRET_ACCESS_KEY")
-	if accessKey == "" || secretKey == "" {
-		return fmt.Errorf("AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY must be set")
-	}
-
-	cfg, err := config.LoadDefaultConfig(context.TODO(),
-		config.WithRegion("auto"),
-		config.WithCredentialsProvider(credentials.NewStaticCredentialsProvider(
-			accessKey,
-			secretKey,
-			"",
-		)),
+// verifyToken checks an access token's signature against the JWKS, and its
+// algorithm, issuer, audience and times, returning its claims
+func verifyToken(tokenString string) (*auth.CustomClaims, error) {
+	claims := &auth.CustomClaims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, jwks.Keyfunc,
+		jwt.WithValidMethods(allowedAlgorithms),
+		jwt.WithIssuer(issuer),
+		jwt.WithAudience(audience),
+		jwt.WithLeeway(clockSkew),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
 	)
 	if err != nil {
-		return fmt.Errorf("failed to load AWS config: %w", err)
+		return nil, err
 	}
-
-	R2Client = s3.NewFromConfig(cfg, func(o *s3.Options) {
-		o.EndpointResolver = s3.EndpointResolverFromURL(os.Getenv("R2_DEV_ENDPOINT"))
-		o.Region = "auto" // Ensure region is set to "auto" for Cloudflare R2
-		o.UsePathStyle = true
-	})
-
-	return nil
+	return claims, nil
 }
 
 // AuthRequired is a middleware that protects API routes using JWT
@@ -80,53 +84,49 @@ func AuthRequired() fiber.Handler {
 			})
 		}
 
-		// Extract the JWT token from the Authorization header
+		// Extract the JWT token from the Authorization header, or the cookie
+		// browsers send, which needs a CSRF token as well
 		tokenString := c.Get("Authorization")
 		if tokenString != "" {
 			tokenString = strings.TrimPrefix(tokenString, "Bearer ")
+		} else if tokenString = c.Cookies("jwt"); tokenString != "" {
+			if !checkCSRF(c) {
+				return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+					"error": "Missing or invalid CSRF token",
+				})
+			}
 		} else {
 			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
 				"error": "Missing token",
 			})
 		}
 
-		// Parse and validate the token
-		token, err := jwt.Parse(tokenString, jwks.Keyfunc)
-		if err != nil || !token.Valid {
-			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-				"error": "Invalid token",
-			})
-		}
-
-		claims, ok := token.Claims.(jwt.MapClaims)
-		if !ok {
-			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-				"error": "Invalid token claims",
-			})
+		// Swap a session's token that's about to expire for a new one
+		if refreshed := refreshSession(c, tokenString); refreshed != "" {
+			tokenString = refreshed
 		}
 
-		// Extract the 'sub' claim from the token
-		sub, ok := claims["sub"].(string)
-		if !ok {
+		// Parse and validate the token
+		claims, err := verifyToken(tokenString)
+		if err != nil {
+			log.Printf("Rejected token: %v", err)
 			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-				"error": "Invalid token claims: 'sub' missing",
+				"error": "Invalid token",
 			})
 		}
+		sub := claims.Subject
 
 		// Query the database to find the user by Auth0 ID
 		var user models.User
 		result := database.DB.Where("auth0_id = ?", sub).First(&user)
 		if result.Error != nil {
 			// User doesn't exist, create new user
-			email, _ := claims["email"].(string)
-			name, _ := claims["name"].(string)
-			emailVerified, _ := claims["email_verified"].(bool)
 			user = models.User{
-				Email:         email,
-				Name:          name,
-				Picture:       claims["picture"].(string),
+				Email:         claims.Email,
+				Name:          claims.Name,
+				Picture:       claims.Picture,
 				Auth0ID:       sub,
-				EmailVerified: emailVerified,
+				EmailVerified: claims.EmailVerified,
 			}
 			if err := database.DB.Create(&user).Error; err != nil {
 				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
@@ -135,12 +135,9 @@ func AuthRequired() fiber.Handler {
 			}
 		} else {
 			// User exists, update information if necessary
-			email, _ := claims["email"].(string)
-			name, _ := claims["name"].(string)
-			emailVerified, _ := claims["email_verified"].(bool)
-			user.Email = email
-			user.Name = name
-			user.EmailVerified = emailVerified
+			user.Email = claims.Email
+			user.Name = claims.Name
+			user.EmailVerified = claims.EmailVerified
 			if err := database.DB.Save(&user).Error; err != nil {
 				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 					"error": "Failed to update user in database",
@@ -157,43 +154,3 @@ func AuthRequired() fiber.Handler {
 		return c.Next()
 	}
 }
-
-// func verifyAudience(claims jwt.MapClaims, expectedAudience string) error {
-// 	audValue, ok := claims["aud"]
-// 	if !ok {
-// 		return errors.New("audience claim is missing")
-// 	}
-
-// 	switch aud := audValue.(type) {
-// 	case string:
-// 		if aud != expectedAudience {
-// 			return errors.New("invalid audience")
-// 		}
-// 	case []interface{}:
-// 		found := false
-// 		for _, a := range aud {
-// 			if aStr, ok := a.(string); ok && aStr == expectedAudience {
-// 				found = true
-// 				break
-// 			}
-// 		}
-// 		if !found {
-// 			return errors.New("invalid audience")
-// 		}
-// 	default:
-// 		return errors.New("invalid audience claim format")
-// 	}
-
-// 	return nil
-// }
-
-// func verifyIssuer(claims jwt.MapClaims, expectedIssuer string) error {
-// 	iss, ok := claims["iss"].(string)
-// 	if !ok {
-// 		return errors.New("issuer claim is missing or invalid")
-// 	}
-// 	if iss != expectedIssuer {
-// 		return errors.New("invalid issuer")
-// 	}
-// 	return nil
-// }
@@ -0,0 +1,123 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	testIssuer   = "https://tenant.example.com/"
+	testAudience = "https://api.example.com"
+)
+
+func TestVerifyToken(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []map[string]string{{
+				"kty": "RSA",
+				"kid": "test-key",
+				"alg": "RS256",
+				"use": "sig",
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			}},
+		})
+	}))
+	defer server.Close()
+
+	if err := initializeJWKS(server.URL, testIssuer, testAudience); err != nil {
+		t.Fatalf("Failed to initialize JWKS: %v", err)
+	}
+	defer func() { jwks = nil }()
+
+	now := time.Now()
+	valid := func() jwt.MapClaims {
+		return jwt.MapClaims{
+			"iss":   testIssuer,
+			"sub":   "auth0|123",
+			"aud":   []string{testAudience, testIssuer + "userinfo"},
+			"iat":   now.Unix(),
+			"exp":   now.Add(time.Hour).Unix(),
+			"email": "ana@example.com",
+		}
+	}
+	with := func(key string, value interface{}) jwt.MapClaims {
+		claims := valid()
+		if value == nil {
+			delete(claims, key)
+		} else {
+			claims[key] = value
+		}
+		return claims
+	}
+	sign := func(method jwt.SigningMethod, signingKey interface{}, kid string, claims jwt.MapClaims) string {
+		token := jwt.NewWithClaims(method, claims)
+		token.Header["kid"] = kid
+		signed, err := token.SignedString(signingKey)
+		if err != nil {
+			t.Fatalf("Failed to sign token: %v", err)
+		}
+		return signed
+	}
+	rs256 := func(claims jwt.MapClaims) string {
+		return sign(jwt.SigningMethodRS256, key, "test-key", claims)
+	}
+
+	tests := []struct {
+		name  string
+		token string
+		valid bool
+	}{
+		{"valid", rs256(valid()), true},
+		{"single audience", rs256(with("aud", testAudience)), true},
+		{"expired within clock skew", rs256(with("exp", now.Add(-10*time.Second).Unix())), true},
+		{"expired", rs256(with("exp", now.Add(-time.Minute).Unix())), false},
+		{"no expiry", rs256(with("exp", nil)), false},
+		{"not yet valid", rs256(with("nbf", now.Add(time.Minute).Unix())), false},
+		{"issued in the future", rs256(with("iat", now.Add(time.Minute).Unix())), false},
+		{"wrong issuer", rs256(with("iss", "https://evil.example.com/")), false},
+		{"no issuer", rs256(with("iss", nil)), false},
+		{"wrong audience", rs256(with("aud", "https://other.example.com")), false},
+		{"no audience", rs256(with("aud", nil)), false},
+		{"no subject", rs256(with("sub", nil)), false},
+		{"signed by another key", sign(jwt.SigningMethodRS256, otherKey, "test-key", valid()), false},
+		{"unknown kid", sign(jwt.SigningMethodRS256, key, "other-key", valid()), false},
+		{"RS512", sign(jwt.SigningMethodRS512, key, "test-key", valid()), false},
+		{"HS256 with the public key", sign(jwt.SigningMethodHS256, key.N.Bytes(), "test-key", valid()), false},
+		{"none", sign(jwt.SigningMethodNone, jwt.UnsafeAllowNoneSignatureType, "test-key", valid()), false},
+		{"garbage", "not.a.token", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := verifyToken(tt.token)
+			if tt.valid {
+				if err != nil {
+					t.Fatalf("Expected a valid token, got %v", err)
+				}
+				if claims.Subject != "auth0|123" || claims.Email != "ana@example.com" {
+					t.Errorf("Unexpected claims: %+v", claims)
+				}
+			} else if err == nil {
+				t.Error("Expected the token to be rejected")
+			}
+		})
+	}
+}
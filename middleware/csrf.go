@@ -0,0 +1,54 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"log"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Requests authenticated by the jwt cookie must repeat the csrf_token
+// cookie's value in the X-CSRF-Token header to change anything. Another
+// site can make the browser send the cookies, but can't read them to set
+// the header.
+const (
+	CSRFCookie = "csrf_token"
+	CSRFHeader = "X-CSRF-Token"
+)
+
+// SetCSRFCookie gives the browser a new CSRF token. The cookie isn't HTTP
+// only, as the page's scripts read it.
+func SetCSRFCookie(c *fiber.Ctx) error {
+	token := make([]byte, 32)
+	if _, err := rand.Read(token); err != nil {
+		return err
+	}
+	c.Cookie(&fiber.Cookie{
+		Name:     CSRFCookie,
+		Value:    base64.RawURLEncoding.EncodeToString(token),
+		Expires:  time.Now().Add(SessionLifetime),
+		SameSite: "Lax",
+		Secure:   true,
+	})
+	return nil
+}
+
+// checkCSRF reports whether a request authenticated by cookie may go
+// ahead. Safe requests don't need a CSRF token, but are given one if the
+// browser has none.
+func checkCSRF(c *fiber.Ctx) bool {
+	cookie := c.Cookies(CSRFCookie)
+	switch c.Method() {
+	case fiber.MethodGet, fiber.MethodHead, fiber.MethodOptions:
+		if cookie == "" {
+			if err := SetCSRFCookie(c); err != nil {
+				log.Printf("Failed to set CSRF cookie: %v", err)
+			}
+		}
+		return true
+	}
+	return cookie != "" && subtle.ConstantTimeCompare([]byte(cookie), []byte(c.Get(CSRFHeader))) == 1
+}
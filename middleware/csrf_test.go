@@ -0,0 +1,54 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestCheckCSRF(t *testing.T) {
+	app := fiber.New()
+	app.All("/", func(c *fiber.Ctx) error {
+		if !checkCSRF(c) {
+			return c.SendStatus(fiber.StatusForbidden)
+		}
+		return c.SendStatus(fiber.StatusOK)
+	})
+
+	tests := []struct {
+		name   string
+		method string
+		cookie string
+		header string
+		want   int
+	}{
+		{"safe without token", "GET", "", "", fiber.StatusOK},
+		{"matching token", "POST", "abc", "abc", fiber.StatusOK},
+		{"no header", "POST", "abc", "", fiber.StatusForbidden},
+		{"no cookie", "DELETE", "", "abc", fiber.StatusForbidden},
+		{"different token", "PATCH", "abc", "abd", fiber.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/", nil)
+			if tt.cookie != "" {
+				req.AddCookie(&http.Cookie{Name: CSRFCookie, Value: tt.cookie})
+			}
+			if tt.header != "" {
+				req.Header.Set(CSRFHeader, tt.header)
+			}
+			resp, err := app.Test(req)
+			if err != nil {
+				t.Fatalf("Request failed: %v", err)
+			}
+			if resp.StatusCode != tt.want {
+				t.Errorf("Expected %d, got %d", tt.want, resp.StatusCode)
+			}
+			if tt.method == "GET" && len(resp.Cookies()) == 0 {
+				t.Error("Expected a safe request without a token to be given one")
+			}
+		})
+	}
+}
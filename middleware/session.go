@@ -0,0 +1,214 @@
+package middleware
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/1rvyn/halloween-story-generator/auth"
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/session"
+	"golang.org/x/oauth2"
+	"golang.org/x/sync/singleflight"
+)
+
+// SessionLifetime is how long a login lasts without being used
+const SessionLifetime = 30 * 24 * time.Hour
+
+// refreshWindow is how long before it expires an access token is replaced
+const refreshWindow = 5 * time.Minute
+
+// Keys of what a login session holds
+const (
+	sessionUserID        = "user_id"
+	sessionSubject       = "sub"
+	sessionAccessToken   = "access_token"
+	sessionRefreshToken  = "refresh_token" // Encrypted
+	sessionExpiresAt     = "expires_at"    // Of the access token, in Unix seconds
+	sessionPreviousToken = "previous_access_token"
+)
+
+// refreshing runs one refresh per session at a time, shared by the requests
+// that need it, so a rotated refresh token is never spent twice
+var refreshing singleflight.Group
+
+// StartSession starts a login session for a user who just logged in, keeping
+// their refresh token, encrypted, for refreshing the access token later
+func StartSession(c *fiber.Ctx, userID uint, sub string, token *oauth2.Token) error {
+	if SessionStore == nil {
+		return errors.New("session store is not initialized")
+	}
+	sess, err := SessionStore.Get(c)
+	if err != nil {
+		return err
+	}
+	// A new ID on login, so a session ID planted before it is useless
+	if err := sess.Regenerate(); err != nil {
+		return err
+	}
+	sess.Set(sessionUserID, userID)
+	sess.Set(sessionSubject, sub)
+	if err := storeToken(sess, token); err != nil {
+		return err
+	}
+	SetTokenCookie(c, token.AccessToken)
+	if err := SetCSRFCookie(c); err != nil {
+		return err
+	}
+	return sess.Save()
+}
+
+// EndSession revokes the session's refresh token and deletes the session
+func EndSession(c *fiber.Ctx) error {
+	c.Cookie(&fiber.Cookie{
+		Name:     "jwt",
+		Expires:  time.Unix(0, 0),
+		HTTPOnly: true,
+		SameSite: "Lax",
+		Secure:   true,
+	})
+	c.Cookie(&fiber.Cookie{
+		Name:     CSRFCookie,
+		Expires:  time.Unix(0, 0),
+		SameSite: "Lax",
+		Secure:   true,
+	})
+	if SessionStore == nil {
+		return nil
+	}
+	sess, err := SessionStore.Get(c)
+	if err != nil {
+		return err
+	}
+	if encrypted, ok := sess.Get(sessionRefreshToken).(string); ok {
+		refreshToken, err := auth.Decrypt(encrypted)
+		if err == nil {
+			err = auth.Revoke(c.Context(), refreshToken)
+		}
+		if err != nil {
+			// The session is still ended, leaving the token unusable here
+			log.Printf("Failed to revoke refresh token: %v", err)
+		}
+	}
+	return sess.Destroy()
+}
+
+// SetTokenCookie gives the browser an access token
+func SetTokenCookie(c *fiber.Ctx, accessToken string) {
+	c.Cookie(&fiber.Cookie{
+		Name:     "jwt",
+		Value:    accessToken,
+		Expires:  time.Now().Add(SessionLifetime), // Kept past the token's expiry, for it to be refreshed
+		HTTPOnly: true,
+		SameSite: "Lax",
+		Secure:   true,
+	})
+}
+
+// refreshSession returns a new access token when tokenString is the one the
+// request's session holds and it's about to expire, or "" when there is
+// nothing to refresh. The new token is also sent back, in the jwt cookie and
+// the X-Access-Token header for clients that send it themselves.
+func refreshSession(c *fiber.Ctx, tokenString string) string {
+	if SessionStore == nil || tokenString == "" {
+		return ""
+	}
+	sess, err := SessionStore.Get(c)
+	if err != nil || sess.Fresh() {
+		return ""
+	}
+
+	// A request still sending the token a refresh just replaced gets the
+	// replacement, rather than spending the refresh token again
+	if holdsToken(sess.Get(sessionPreviousToken), tokenString) {
+		current, _ := sess.Get(sessionAccessToken).(string)
+		sendToken(c, current)
+		return current
+	}
+	if !holdsToken(sess.Get(sessionAccessToken), tokenString) {
+		return ""
+	}
+	if expiresAt, _ := sess.Get(sessionExpiresAt).(int64); time.Until(time.Unix(expiresAt, 0)) > refreshWindow {
+		return ""
+	}
+
+	// Concurrent requests of the session share one refresh
+	result, _, _ := refreshing.Do(sess.ID(), func() (interface{}, error) {
+		return refreshStoredToken(c, tokenString), nil
+	})
+	accessToken := result.(string)
+	if accessToken != "" {
+		sendToken(c, accessToken)
+	}
+	return accessToken
+}
+
+// refreshStoredToken swaps the session's tokens for new ones, unless a
+// refresh that finished just before already did
+func refreshStoredToken(c *fiber.Ctx, tokenString string) string {
+	sess, err := SessionStore.Get(c)
+	if err != nil || sess.Fresh() {
+		return ""
+	}
+	if current, _ := sess.Get(sessionAccessToken).(string); current != tokenString {
+		if holdsToken(sess.Get(sessionPreviousToken), tokenString) {
+			return current
+		}
+		return ""
+	}
+
+	encrypted, _ := sess.Get(sessionRefreshToken).(string)
+	if encrypted == "" {
+		return ""
+	}
+	refreshToken, err := auth.Decrypt(encrypted)
+	if err != nil {
+		log.Printf("Failed to decrypt refresh token: %v", err)
+		return ""
+	}
+	// Not the request's context, other requests are waiting on this refresh
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	token, err := auth.Refresh(ctx, refreshToken)
+	if err != nil {
+		// Most likely revoked or expired, so the user logs in again
+		log.Printf("Failed to refresh access token: %v", err)
+		return ""
+	}
+	if err := storeToken(sess, token); err != nil {
+		log.Printf("Failed to store refreshed token: %v", err)
+		return ""
+	}
+	sess.Set(sessionPreviousToken, tokenString)
+	if err := sess.Save(); err != nil {
+		log.Printf("Failed to save session: %v", err)
+		return ""
+	}
+	return token.AccessToken
+}
+
+// sendToken gives the client a refreshed access token
+func sendToken(c *fiber.Ctx, accessToken string) {
+	SetTokenCookie(c, accessToken)
+	c.Set("X-Access-Token", accessToken)
+}
+
+func storeToken(sess *session.Session, token *oauth2.Token) error {
+	if token.RefreshToken != "" {
+		encrypted, err := auth.Encrypt(token.RefreshToken)
+		if err != nil {
+			return err
+		}
+		sess.Set(sessionRefreshToken, encrypted)
+	}
+	sess.Set(sessionAccessToken, token.AccessToken)
+	sess.Set(sessionExpiresAt, token.Expiry.Unix())
+	return nil
+}
+
+func holdsToken(stored interface{}, tokenString string) bool {
+	s, ok := stored.(string)
+	return ok && subtle.ConstantTimeCompare([]byte(s), []byte(tokenString)) == 1
+}
@@ -0,0 +1,146 @@
+package middleware
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/1rvyn/halloween-story-generator/auth"
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/session"
+	"golang.org/x/oauth2"
+)
+
+func TestRefreshSession(t *testing.T) {
+	var refreshedWith string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		refreshedWith = r.Form.Get("refresh_token")
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token":  "access-2",
+			"refresh_token": "refresh-2",
+			"token_type":    "Bearer",
+			"expires_in":    3600,
+		})
+	}))
+	defer server.Close()
+
+	app, sessionCookie := sessionTestApp(t, server.URL)
+
+	call := func(token string) (string, *http.Response) {
+		req := httptest.NewRequest("GET", "/api", nil)
+		req.AddCookie(sessionCookie)
+		req.Header.Set("Authorization", token)
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		var body [64]byte
+		n, _ := resp.Body.Read(body[:])
+		return string(body[:n]), resp
+	}
+
+	if got, _ := call("someone-elses-token"); got != "" {
+		t.Errorf("Expected a token the session doesn't hold not to be refreshed, got %q", got)
+	}
+	got, resp := call("access-1")
+	if got != "access-2" || refreshedWith != "refresh-1" || resp.Header.Get("X-Access-Token") != "access-2" {
+		t.Errorf("Expected a refresh to access-2 with refresh-1, got %q with %q", got, refreshedWith)
+	}
+	// The new token has an hour left, so isn't refreshed again
+	if got, _ := call("access-2"); got != "" {
+		t.Errorf("Expected a fresh token to be kept, got %q", got)
+	}
+}
+
+// sessionTestApp logs in against a token endpoint at tokenURL, returning an
+// app whose /api route refreshes the Authorization header's token and the
+// session cookie to send. The session's access-1 token expires in a minute.
+func sessionTestApp(t *testing.T, tokenURL string) (*fiber.App, *http.Cookie) {
+	if err := auth.Initialize(); err != nil {
+		t.Fatalf("Failed to initialize auth: %v", err)
+	}
+	auth.Config.Endpoint.TokenURL = tokenURL
+	SetSessionStore(session.New())
+	t.Cleanup(func() { SetSessionStore(nil) })
+
+	app := fiber.New()
+	app.Get("/login", func(c *fiber.Ctx) error {
+		return StartSession(c, 1, "auth0|1", &oauth2.Token{
+			AccessToken:  "access-1",
+			RefreshToken: "refresh-1",
+			Expiry:       time.Now().Add(time.Minute),
+		})
+	})
+	app.Get("/api", func(c *fiber.Ctx) error {
+		return c.SendString(refreshSession(c, c.Get("Authorization")))
+	})
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/login", nil))
+	if err != nil {
+		t.Fatalf("Login failed: %v", err)
+	}
+	var sessionCookie *http.Cookie
+	for _, cookie := range resp.Cookies() {
+		if cookie.Name == "session_id" {
+			sessionCookie = cookie
+		}
+	}
+	if sessionCookie == nil {
+		t.Fatal("Expected a session cookie")
+	}
+
+	return app, sessionCookie
+}
+
+func TestRefreshSessionConcurrent(t *testing.T) {
+	var refreshes int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&refreshes, 1)
+		time.Sleep(50 * time.Millisecond) // Long enough for the requests to pile up
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token":  "access-2",
+			"refresh_token": "refresh-2",
+			"token_type":    "Bearer",
+			"expires_in":    3600,
+		})
+	}))
+	defer server.Close()
+	app, sessionCookie := sessionTestApp(t, server.URL)
+
+	var wg sync.WaitGroup
+	got := make([]string, 8)
+	for i := range got {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			req := httptest.NewRequest("GET", "/api", nil)
+			req.AddCookie(sessionCookie)
+			req.Header.Set("Authorization", "access-1")
+			resp, err := app.Test(req, -1)
+			if err != nil {
+				t.Errorf("Request failed: %v", err)
+				return
+			}
+			body, _ := io.ReadAll(resp.Body)
+			got[i] = string(body)
+		}(i)
+	}
+	wg.Wait()
+
+	if n := atomic.LoadInt32(&refreshes); n != 1 {
+		t.Errorf("Expected one refresh, got %d", n)
+	}
+	for i, token := range got {
+		if token != "access-2" {
+			t.Errorf("Expected request %d to get access-2, got %q", i, token)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package misc
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"os/exec"
+	"path/filepath"
+)
+
+const (
+	defaultAmbientVolume = 0.3
+	ambientFadeSeconds   = 2
+)
+
+// MixAmbient loops an ambient track under a video's narration. The track
+// fades in and out, and is ducked by a sidechain compressor keyed on the
+// narration, so it swells in the pauses without drowning out the voice.
+// The video stream is copied; only the audio is re-encoded.
+func MixAmbient(storyID int, profile, videoPath, ambientPath string, volume float64) (string, error) {
+	if volume == 0 {
+		volume = defaultAmbientVolume
+	}
+
+	duration, err := ProbeDuration(videoPath)
+	if err != nil {
+		return "", fmt.Errorf("probing video: %w", err)
+	}
+
+	tempDir, err := TempDirectory()
+	if err != nil {
+		return "", err
+	}
+	mixedPath := filepath.Join(tempDir, fmt.Sprintf("story_%d_mixed_%s.mp4", storyID, profile))
+
+	ffmpegCmd := exec.Command("ffmpeg",
+		"-y",
+		"-i", videoPath,
+		"-stream_loop", "-1",
+		"-i", ambientPath,
+		"-filter_complex", ambientFilter(duration, volume),
+		"-map", "0:v",
+		"-map", "[aout]",
+		"-c:v", "copy",
+		"-c:a", "aac",
+		"-t", fmt.Sprintf("%.3f", duration),
+		mixedPath,
+	)
+
+	var stderr bytes.Buffer
+	ffmpegCmd.Stderr = &stderr
+	if err := ffmpegCmd.Run(); err != nil {
+		log.Printf("FFmpeg ambient mix error for story %d: %v, Details: %s", storyID, err, stderr.String())
+		return "", err
+	}
+
+	return mixedPath, nil
+}
+
+// ambientFilter mixes input 1, the looped ambient track, under input 0's narration
+func ambientFilter(duration, volume float64) string {
+	fadeOut := duration - ambientFadeSeconds
+	if fadeOut < 0 {
+		fadeOut = 0
+	}
+	return fmt.Sprintf(
+		"[1:a]aformat=sample_rates=44100:channel_layouts=stereo,volume=%.3f,"+
+			"afade=t=in:d=%d,afade=t=out:st=%.3f:d=%d[bed];"+
+			"[0:a]aformat=sample_rates=44100:channel_layouts=stereo,asplit=2[voice][key];"+
+			"[bed][key]sidechaincompress=threshold=0.02:ratio=8:attack=50:release=600[ducked];"+
+			"[voice][ducked]amix=inputs=2:duration=first:normalize=0[aout]",
+		volume, ambientFadeSeconds, fadeOut, ambientFadeSeconds,
+	)
+}
@@ -0,0 +1,81 @@
+package misc
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"os/exec"
+	"path/filepath"
+	"sort"
+)
+
+// AmbientBedExt is the format the built-in ambient beds are rendered in
+const AmbientBedExt = ".mp3"
+
+// ambientBedSeconds is the length of a rendered bed. Every cycle in the
+// filters below divides it, so the bed loops without a seam.
+const ambientBedSeconds = 60
+
+// ambientBeds are the built-in ambient tracks, synthesized by ffmpeg so the
+// library isn't empty on a fresh deploy. Each is a filter graph ending in [out].
+var ambientBeds = map[string]string{
+	// Pink noise through a band pass, rising and falling in gusts
+	"wind": "anoisesrc=c=pink:r=44100:a=0.5:d=60," +
+		"bandpass=f=400:w=300," +
+		"volume='0.45+0.35*sin(2*PI*t/10)+0.15*sin(2*PI*t/4)':eval=frame[out]",
+
+	// Hissing rain over a low rumble that swells into thunder every 20 seconds
+	"storm": "anoisesrc=c=white:r=44100:a=0.2:d=60,highpass=f=1000,lowpass=f=8000[rain];" +
+		"anoisesrc=c=brown:r=44100:a=0.9:d=60,lowpass=f=150," +
+		"volume='0.25+0.75*pow(max(0,sin(2*PI*t/20)),8)':eval=frame[rumble];" +
+		"[rain][rumble]amix=inputs=2:normalize=0[out]",
+
+	// Low room tone, and a creak, a burst of stick-slip clicks, every 7.5 seconds
+	"creaking-house": "anoisesrc=c=brown:r=44100:a=0.3:d=60,lowpass=f=200[room];" +
+		"aevalsrc='0.5*sin(2*PI*220*t)*pow(abs(sin(2*PI*(20+10*mod(t,7.5))*t)),20)" +
+		"*between(mod(t,7.5),0,1.2)*sin(PI*min(mod(t,7.5),1.2)/1.2)':s=44100:d=60[creak];" +
+		"[room][creak]amix=inputs=2:normalize=0[out]",
+}
+
+// AmbientBedNames returns the names of the built-in ambient beds
+func AmbientBedNames() []string {
+	names := make([]string, 0, len(ambientBeds))
+	for name := range ambientBeds {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// RenderAmbientBed synthesizes a built-in ambient bed and returns its local path
+func RenderAmbientBed(name string) (string, error) {
+	filter, ok := ambientBeds[name]
+	if !ok {
+		return "", fmt.Errorf("unknown ambient bed %q", name)
+	}
+
+	tempDir, err := TempDirectory()
+	if err != nil {
+		return "", err
+	}
+	bedPath := filepath.Join(tempDir, "ambient_"+name+AmbientBedExt)
+
+	ffmpegCmd := exec.Command("ffmpeg",
+		"-y",
+		"-filter_complex", filter,
+		"-map", "[out]",
+		"-ac", "2",
+		"-t", fmt.Sprint(ambientBedSeconds),
+		"-c:a", "libmp3lame",
+		"-q:a", "4",
+		bedPath,
+	)
+
+	var stderr bytes.Buffer
+	ffmpegCmd.Stderr = &stderr
+	if err := ffmpegCmd.Run(); err != nil {
+		log.Printf("FFmpeg error rendering ambient bed %s: %v, Details: %s", name, err, stderr.String())
+		return "", err
+	}
+	return bedPath, nil
+}
@@ -2,10 +2,9 @@ package misc
 
 import (
 	"bytes"
+	"context"
 	"fmt"
-	"io"
 	"log"
-	"net/http"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -16,59 +15,34 @@ import (
 	"time"
 
 	"github.com/1rvyn/halloween-story-generator/models"
+	"github.com/1rvyn/halloween-story-generator/narrator"
 )
 
-type SegmentVideo struct {
-	Segment   models.Segment
-	VideoPath string
-	AudioPath string
-}
-
 // GenerateFfmpegInputFile handles the video creation process using ffmpeg and OpenAI TTS.
 func GenerateFfmpegInputFile(storyID int, segments []models.Segment) (string, error) {
 	startTime := time.Now()
-	story := struct {
-		ID       int
-		Segments []SegmentVideo
-	}{
-		ID:       storyID,
-		Segments: make([]SegmentVideo, len(segments)),
-	}
 
-	for i, seg := range segments {
-		story.Segments[i] = SegmentVideo{
-			Segment: seg,
-		}
+	if len(segments) == 0 {
+		return "", fmt.Errorf("story %d has no segments to render", storyID)
 	}
 
-	// Frame rate
-	frameRate := 6
-
-	tempDir := ""
-	if runtime.GOOS == "darwin" {
-		tempDir = "/tmp/temp" // Use macOS temporary directory
-	} else {
-		tempDir = "/dev/shm/temp" // Use Linux RAM-backed storage
-	}
-	// Use RAM-backed storage for faster disk operations
-	if _, err := os.Stat(tempDir); os.IsNotExist(err) {
-		err := os.Mkdir(tempDir, 0755)
-		if err != nil {
-			log.Fatalf("Failed to create temp directory: %v", err)
-		}
+	tempDir, err := TempDirectory()
+	if err != nil {
+		return "", err
 	}
 
-	// Pre-allocate slice to hold paths of temporary segment videos
-	segmentVideos := make([]string, len(story.Segments))
+	// Pre-allocate slices to hold paths of temporary segment videos and audio
+	segmentVideos := make([]string, len(segments))
+	segmentAudio := make([]string, len(segments))
 	sem := make(chan struct{}, 2) // Limit to 2 concurrent FFmpeg processes
 
 	// WaitGroup to synchronize goroutines
 	var wg sync.WaitGroup
 
 	// Channel to capture errors from goroutines
-	errChan := make(chan error, len(story.Segments))
+	errChan := make(chan error, len(segments))
 
-	for idx, segment := range story.Segments {
+	for idx, segment := range segments {
 		idx := idx         // capture loop variable
 		segment := segment // capture loop variable
 		wg.Add(1)
@@ -77,77 +51,24 @@ func GenerateFfmpegInputFile(storyID int, segments []models.Segment) (string, er
 			sem <- struct{}{}        // Acquire semaphore
 			defer func() { <-sem }() // Release semaphore
 
-			// Generate TTS audio for the segment text and get duration
-			audioPath, audioDuration, err := getTTS(segment.Segment.Segment, story.ID, idx, tempDir)
-			if err != nil {
-				errChan <- err
-				return
-			}
-
-			// Temporary video path for the segment
-			segmentVideoPath := filepath.Join(tempDir, fmt.Sprintf("segment_%d.mp4", idx+1))
-			segmentVideos[idx] = segmentVideoPath
-
-			// Calculate the number of frames for the segment
-			segmentFrames := int(audioDuration * float64(frameRate))
-
-			// Construct the filter complex
-			filterComplex := fmt.Sprintf(
-				"[0]scale=1344:-2,setsar=1:1[out];[out]crop=1344:768[out];[out]scale=4000:-1,zoompan=z='zoom+0.001':x=iw/2-(iw/zoom/2):y=ih/2-(ih/zoom/2):d=%d:s=1344x768:fps=%d[out]",
-				segmentFrames, frameRate,
-			)
-
-			// FFmpeg command to create a video for the segment with audio merged in one step
-			ffmpegCmd := exec.Command("ffmpeg",
-				"-y",
-				"-f", "image2pipe",
-				"-i", "pipe:0",
-				"-i", audioPath,
-				"-filter_complex", filterComplex,
-				"-c:v", "libx264",
-				"-preset", "ultrafast",
-				"-tune", "stillimage",
-				"-t", fmt.Sprintf("%.2f", audioDuration),
-				"-pix_fmt", "yuv420p",
-				"-r", fmt.Sprintf("%d", frameRate),
-				"-threads", "4",
-				"-map", "[out]",
-				"-map", "1:a",
-				"-shortest",
-				segmentVideoPath,
-			)
-
-			// Create a pipe to write the image data
-			stdin, err := ffmpegCmd.StdinPipe()
-			if err != nil {
-				errChan <- fmt.Errorf("error creating stdin pipe: %w", err)
-				return
-			}
-
-			// Capture stderr for debugging
-			var stderr bytes.Buffer
-			ffmpegCmd.Stderr = &stderr
-
-			// Start the FFmpeg command
-			if err := ffmpegCmd.Start(); err != nil {
-				errChan <- fmt.Errorf("error starting FFmpeg: %w", err)
-				return
+			// Use the narration from NarrateSegments if we have it, otherwise generate it now
+			if segment.AudioPath == "" {
+				audioPath, audioDuration, err := getTTS(segment.Segment, storyID, idx, tempDir)
+				if err != nil {
+					errChan <- err
+					return
+				}
+				segment.AudioPath = audioPath
+				segment.Duration = audioDuration
+				segmentAudio[idx] = audioPath
 			}
 
-			// Write the image data to stdin
-			_, err = stdin.Write(segment.Segment.ImageData)
+			segmentVideoPath, err := RenderSegmentClip(storyID, idx, segment, ClipOptions{})
 			if err != nil {
-				errChan <- fmt.Errorf("error writing image data to stdin: %w", err)
-				return
-			}
-			stdin.Close()
-
-			log.Printf("Creating segment video with audio: %s", segmentVideoPath)
-			if err := ffmpegCmd.Wait(); err != nil {
-				log.Printf("FFmpeg error for segment %d: %v, Details: %s", idx+1, err, stderr.String())
 				errChan <- err
 				return
 			}
+			segmentVideos[idx] = segmentVideoPath
 		}()
 	}
 
@@ -162,129 +83,320 @@ func GenerateFfmpegInputFile(storyID int, segments []models.Segment) (string, er
 		}
 	}
 
-	// Create the FFmpeg concat input file
-	concatListPath := filepath.Join(tempDir, fmt.Sprintf("story_%d_concat.txt", story.ID))
-	concatFile, err := os.Create(concatListPath)
+	// Clean up temporary segment videos and the audio generated here after final video creation
+	defer func() {
+		for i, segmentVideo := range segmentVideos {
+			// Remove segment video
+			if err := os.Remove(segmentVideo); err != nil {
+				log.Printf("Warning: Failed to remove temporary video file %s: %v", segmentVideo, err)
+			}
+
+			// Remove corresponding audio file
+			if audioFile := segmentAudio[i]; audioFile != "" {
+				if err := os.Remove(audioFile); err != nil {
+					log.Printf("Warning: Failed to remove temporary audio file %s: %v", audioFile, err)
+				}
+			}
+		}
+	}()
+
+	videoPath, err := ConcatClips(storyID, DefaultProfile.Name, segmentVideos, Transition{})
+	if err != nil {
+		return "", err
+	}
+
+	duration := time.Since(startTime).Seconds()
+	log.Printf("Total time taken: %.2f seconds", duration)
+
+	return videoPath, nil
+}
+
+// ClipOptions are the per-story choices for how a segment's clip is rendered
+type ClipOptions struct {
+	Profile   Profile       // Output geometry, the zero value for DefaultProfile
+	Captions  *CaptionStyle // Burn the segment's text into the frames, nil for no captions
+	Motion    string        // Camera motion preset, see ResolveMotion. Empty for the original slow zoom
+	FrameRate int           // 6, 24 or 30, 0 for 6
+}
+
+// RenderSegmentClip renders one segment's image and narration into a video clip.
+// The segment must already have ImageData, AudioPath and Duration filled in.
+func RenderSegmentClip(storyID, idx int, segment models.Segment, opts ClipOptions) (string, error) {
+	// Frame rate
+	frameRate := opts.FrameRate
+	if frameRate == 0 {
+		frameRate = defaultFrameRate
+	}
+
+	tempDir, err := TempDirectory()
 	if err != nil {
-		log.Printf("Error creating concat file: %v", err)
 		return "", err
 	}
-	defer concatFile.Close()
 
-	for _, segmentVideo := range segmentVideos {
-		concatFile.WriteString(fmt.Sprintf("file '%s'\n", segmentVideo))
+	audioPath, audioDuration := segment.AudioPath, segment.Duration
+	profile := profileOrDefault(opts.Profile)
+
+	// Temporary video path for the segment
+	segmentVideoPath := ClipPath(tempDir, storyID, idx, profile.Name)
+
+	// Calculate the number of frames for the segment
+	segmentFrames := int(audioDuration * float64(frameRate))
+
+	// Construct the filter complex. The image is scaled to cover the frame and
+	// cropped to it, then upscaled before zoompan so slow motion doesn't jitter.
+	zoom, x, y := zoompanExpressions(opts.Motion, max(segmentFrames, 1), frameRate)
+	filterComplex := fmt.Sprintf(
+		"[0]scale=%[1]d:%[2]d:force_original_aspect_ratio=increase,setsar=1:1[out];[out]crop=%[1]d:%[2]d[out];[out]scale=%[3]d:-2,zoompan=z='%[6]s':x='%[7]s':y='%[8]s':d=%[4]d:s=%[1]dx%[2]d:fps=%[5]d[out]",
+		profile.Width, profile.Height, 3*profile.Width, segmentFrames, frameRate, zoom, x, y,
+	)
+
+	if opts.Captions != nil {
+		captions, assPath, err := captionFilter(*opts.Captions, profile, storyID, idx, segment, audioDuration)
+		if err != nil {
+			return "", fmt.Errorf("error writing captions: %w", err)
+		}
+		defer os.Remove(assPath)
+		filterComplex += ";[out]" + captions + "[out]"
+	}
+
+	// Smooth motion is worth a slower encode, the stepping 6 fps default isn't
+	preset := "ultrafast"
+	if frameRate > defaultFrameRate {
+		preset = "veryfast"
 	}
 
-	// Create the final video by concatenating all segment videos
-	videoPath := filepath.Join(tempDir, fmt.Sprintf("story_%d_video.mp4", story.ID))
-	ffmpegConcatCmd := exec.Command("ffmpeg",
+	// FFmpeg command to create a video for the segment with audio merged in one step
+	ffmpegCmd := exec.Command("ffmpeg",
 		"-y",
-		"-f", "concat",
-		"-safe", "0",
-		"-i", concatListPath,
-		"-c", "copy",
-		"-fps_mode", "cfr",
-		videoPath,
+		"-f", "image2pipe",
+		"-i", "pipe:0",
+		"-i", audioPath,
+		"-filter_complex", filterComplex,
+		"-c:v", "libx264",
+		"-preset", preset,
+		"-tune", "stillimage",
+		"-t", fmt.Sprintf("%.2f", audioDuration),
+		"-pix_fmt", "yuv420p",
+		"-r", fmt.Sprintf("%d", frameRate),
+		"-threads", "4",
+		"-map", "[out]",
+		"-map", "1:a",
+		"-shortest",
+		segmentVideoPath,
 	)
 
+	// Create a pipe to write the image data
+	stdin, err := ffmpegCmd.StdinPipe()
+	if err != nil {
+		return "", fmt.Errorf("error creating stdin pipe: %w", err)
+	}
+
 	// Capture stderr for debugging
-	var stderrConcat bytes.Buffer
-	ffmpegConcatCmd.Stderr = &stderrConcat
+	var stderr bytes.Buffer
+	ffmpegCmd.Stderr = &stderr
 
-	if err := ffmpegConcatCmd.Run(); err != nil {
-		log.Printf("FFmpeg concat error: %v, Details: %s", err, stderrConcat.String())
+	// Start the FFmpeg command
+	if err := ffmpegCmd.Start(); err != nil {
+		return "", fmt.Errorf("error starting FFmpeg: %w", err)
+	}
+
+	// Write the image data to stdin
+	_, err = stdin.Write(segment.ImageData)
+	if err != nil {
+		return "", fmt.Errorf("error writing image data to stdin: %w", err)
+	}
+	stdin.Close()
+
+	log.Printf("Creating segment video with audio: %s", segmentVideoPath)
+	if err := ffmpegCmd.Wait(); err != nil {
+		log.Printf("FFmpeg error for segment %d: %v, Details: %s", idx+1, err, stderr.String())
 		return "", err
 	}
 
-	duration := time.Since(startTime).Seconds()
-	log.Printf("Total time taken: %.2f seconds", duration)
+	return segmentVideoPath, nil
+}
 
-	// Clean up temporary segment videos, audio files, and concat file after final video creation
-	defer func() {
-		for i, segmentVideo := range segmentVideos {
-			// Remove segment video
-			if err := os.Remove(segmentVideo); err != nil {
-				log.Printf("Warning: Failed to remove temporary video file %s: %v", segmentVideo, err)
-			}
+// ClipPath is where RenderSegmentClip writes the clip for a segment in a profile
+func ClipPath(tempDir string, storyID, idx int, profile string) string {
+	return filepath.Join(tempDir, fmt.Sprintf("story_%d_segment_%d_%s.mp4", storyID, idx+1, profile))
+}
 
-			// Remove corresponding audio file
-			audioFile := filepath.Join(tempDir, fmt.Sprintf("speech_%d_seg_%d.mp3", story.ID, i))
-			if err := os.Remove(audioFile); err != nil {
-				log.Printf("Warning: Failed to remove temporary audio file %s: %v", audioFile, err)
-			}
+// ConcatClips joins the segment clips, in order, into the final story video.
+// Hard cuts are copied straight through, other transitions re-encode.
+func ConcatClips(storyID int, profile string, segmentVideos []string, transition Transition) (string, error) {
+	tempDir, err := TempDirectory()
+	if err != nil {
+		return "", err
+	}
+	videoPath := filepath.Join(tempDir, fmt.Sprintf("story_%d_video_%s.mp4", storyID, profile))
+
+	var ffmpegConcatCmd *exec.Cmd
+	if transition.isCut() || len(segmentVideos) < 2 {
+		// Create the FFmpeg concat input file
+		concatListPath := filepath.Join(tempDir, fmt.Sprintf("story_%d_concat_%s.txt", storyID, profile))
+		concatFile, err := os.Create(concatListPath)
+		if err != nil {
+			log.Printf("Error creating concat file: %v", err)
+			return "", err
 		}
+		defer os.Remove(concatListPath)
 
-		// Remove concat list file
-		if err := os.Remove(concatListPath); err != nil {
-			log.Printf("Warning: Failed to remove concat list file %s: %v", concatListPath, err)
+		for _, segmentVideo := range segmentVideos {
+			concatFile.WriteString(fmt.Sprintf("file '%s'\n", segmentVideo))
 		}
-	}()
+		concatFile.Close()
+
+		// Create the final video by concatenating all segment videos
+		ffmpegConcatCmd = exec.Command("ffmpeg",
+			"-y",
+			"-f", "concat",
+			"-safe", "0",
+			"-i", concatListPath,
+			"-c", "copy",
+			"-fps_mode", "cfr",
+			videoPath,
+		)
+	} else {
+		durations := make([]float64, len(segmentVideos))
+		args := []string{"-y"}
+		for i, segmentVideo := range segmentVideos {
+			if durations[i], err = ProbeDuration(segmentVideo); err != nil {
+				return "", fmt.Errorf("probing clip %s: %w", segmentVideo, err)
+			}
+			args = append(args, "-i", segmentVideo)
+		}
+
+		graph, videoOut, audioOut := transitionFilter(durations, transition)
+		args = append(args,
+			"-filter_complex", graph,
+			"-map", videoOut,
+			"-map", audioOut,
+			"-c:v", "libx264",
+			"-preset", "ultrafast",
+			"-pix_fmt", "yuv420p",
+			"-c:a", "aac",
+			videoPath,
+		)
+		ffmpegConcatCmd = exec.Command("ffmpeg", args...)
+	}
+
+	// Capture stderr for debugging
+	var stderrConcat bytes.Buffer
+	ffmpegConcatCmd.Stderr = &stderrConcat
+
+	if err := ffmpegConcatCmd.Run(); err != nil {
+		log.Printf("FFmpeg concat error: %v, Details: %s", err, stderrConcat.String())
+		return "", err
+	}
 
 	return videoPath, nil
 }
 
-func getTTS(text string, storynumb, idx int, tempDir string) (string, float64, error) {
-	apiKey := os.Getenv("OPENAI_API_KEY")
-	if apiKey == "" {
-		return "", 0, fmt.Errorf("OPENAI_API_KEY environment variable not set")
+// NarrateSegments generates the TTS audio for every segment, filling in AudioPath, Duration and Words.
+// Segments that already have audio, local or stored, are left alone. When some segments
+// fail the rest are still filled in, so callers can keep the audio that did succeed.
+func NarrateSegments(n narrator.Narrator, opts narrator.Options, storyID int, segments []models.Segment) error {
+	tempDir, err := TempDirectory()
+	if err != nil {
+		return err
 	}
 
-	url := "https://api.openai.com/v1/audio/speech"
-
-	// Escape special characters in the text
-	escapedText := strings.ReplaceAll(text, "\"", "\\\"")
-	escapedText = strings.ReplaceAll(escapedText, "\n", "\\n")
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, 4) // Limit concurrent TTS requests
+	errChan := make(chan error, len(segments))
 
-	payload := fmt.Sprintf(`{
-		"model": "tts-1",
-		"input": "%s",
-		"voice": "onyx"
-	}`, escapedText)
+	for i := range segments {
+		if segments[i].AudioPath != "" || segments[i].AudioKey != "" {
+			continue
+		}
+		wg.Add(1)
+		go func(idx int, seg *models.Segment) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
 
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer([]byte(payload)))
-	if err != nil {
-		return "", 0, err
+			audioPath, duration, words, err := narrateToFile(n, opts, seg.Segment, storyID, idx, tempDir)
+			if err != nil {
+				errChan <- fmt.Errorf("narrating segment %d: %w", seg.Number, err)
+				return
+			}
+			seg.AudioPath = audioPath
+			seg.Duration = duration
+			seg.Words = words
+		}(i, &segments[i])
 	}
 
-	req.Header.Set("Authorization", "Bearer "+apiKey)
-	req.Header.Set("Content-Type", "application/json")
+	wg.Wait()
+	close(errChan)
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return "", 0, err
+	for err := range errChan {
+		return err
 	}
-	defer resp.Body.Close()
+	return nil
+}
 
-	if resp.StatusCode != http.StatusOK {
-		bodyBytes, _ := io.ReadAll(resp.Body)
-		return "", 0, fmt.Errorf("API request failed with status %d: %s", resp.StatusCode, string(bodyBytes))
+// TempDirectory returns the scratch directory for audio and video files, creating it if needed.
+func TempDirectory() (string, error) {
+	tempDir := ""
+	if runtime.GOOS == "darwin" {
+		tempDir = "/tmp/temp" // Use macOS temporary directory
+	} else {
+		tempDir = "/dev/shm/temp" // Use Linux RAM-backed storage
+	}
+	// Use RAM-backed storage for faster disk operations
+	if err := os.MkdirAll(tempDir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create temp directory: %w", err)
 	}
+	return tempDir, nil
+}
 
-	outputFile := filepath.Join(tempDir, fmt.Sprintf("speech_%d_seg_%d.mp3", storynumb, idx))
-	out, err := os.Create(outputFile)
+// getTTS narrates text with OpenAI's default voice, for callers without story settings
+func getTTS(text string, storynumb, idx int, tempDir string) (string, float64, error) {
+	n, err := narrator.New("openai")
 	if err != nil {
 		return "", 0, err
 	}
-	defer out.Close()
+	audioPath, duration, _, err := narrateToFile(n, narrator.Options{}, text, storynumb, idx, tempDir)
+	return audioPath, duration, err
+}
 
-	_, err = io.Copy(out, resp.Body)
+// narrateToFile saves the narration for one segment into tempDir and returns its path,
+// duration and word timings
+func narrateToFile(n narrator.Narrator, opts narrator.Options, text string, storynumb, idx int, tempDir string) (string, float64, []models.Word, error) {
+	audio, err := n.Narrate(context.TODO(), text, opts)
 	if err != nil {
-		return "", 0, err
+		return "", 0, nil, err
+	}
+
+	outputFile := filepath.Join(tempDir, fmt.Sprintf("speech_%d_seg_%d.%s", storynumb, idx, audio.Format))
+	if err := os.WriteFile(outputFile, audio.Data, 0644); err != nil {
+		return "", 0, nil, err
+	}
+
+	duration := audio.Duration
+	if duration == 0 {
+		duration, err = ProbeDuration(outputFile)
+		if err != nil {
+			return "", 0, nil, err
+		}
+	}
+
+	// The narrator's own timings are exact, otherwise the audio is aligned
+	words := audio.Words
+	if len(words) == 0 {
+		words = WordTimings(text, outputFile, duration)
 	}
 
-	// After saving the audio file
-	// Get the duration of the audio file using ffprobe
-	ffprobeCmd := exec.Command("ffprobe", "-v", "error", "-show_entries", "format=duration", "-of", "default=noprint_wrappers=1:nokey=1", outputFile)
+	return outputFile, duration, words, nil
+}
+
+// ProbeDuration gets the duration of an audio or video file using ffprobe
+func ProbeDuration(path string) (float64, error) {
+	ffprobeCmd := exec.Command("ffprobe", "-v", "error", "-show_entries", "format=duration", "-of", "default=noprint_wrappers=1:nokey=1", path)
 	var durationStr bytes.Buffer
 	ffprobeCmd.Stdout = &durationStr
 	if err := ffprobeCmd.Run(); err != nil {
-		return "", 0, err
+		return 0, err
 	}
-	duration, err := strconv.ParseFloat(strings.TrimSpace(durationStr.String()), 64)
-	if err != nil {
-		return "", 0, err
-	}
-
-	return outputFile, duration, nil
+	return strconv.ParseFloat(strings.TrimSpace(durationStr.String()), 64)
 }
@@ -0,0 +1,154 @@
+package misc
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// HLSMasterPlaylist is the name of the master playlist PackageHLS writes
+const HLSMasterPlaylist = "master.m3u8"
+
+const hlsSegmentSeconds = 4
+
+// hlsRendition is one bitrate of an HLS ladder
+type hlsRendition struct {
+	Width, Height int
+	VideoBitrate  int // kbit/s
+}
+
+// hlsLadder is keyed by the frame's short side, so vertical and square
+// videos get the same steps as landscape ones
+var hlsLadder = []struct {
+	shortSide, bitrate int
+}{
+	{1080, 5000},
+	{720, 2800},
+	{480, 1400},
+	{360, 800},
+}
+
+// hlsRenditions returns the steps of the ladder no larger than the profile,
+// always including the smallest, which never scales a small profile up
+func hlsRenditions(profile Profile) []hlsRendition {
+	profile = profileOrDefault(profile)
+	shortSide := profile.Height
+	if profile.Width < shortSide {
+		shortSide = profile.Width
+	}
+
+	var renditions []hlsRendition
+	for i, step := range hlsLadder {
+		if step.shortSide > shortSide && i < len(hlsLadder)-1 {
+			continue
+		}
+		scale := math.Min(1, float64(step.shortSide)/float64(shortSide))
+		renditions = append(renditions, hlsRendition{
+			Width:        evenRound(float64(profile.Width) * scale),
+			Height:       evenRound(float64(profile.Height) * scale),
+			VideoBitrate: step.bitrate,
+		})
+	}
+	return renditions
+}
+
+func evenRound(x float64) int {
+	return int(math.Round(x/2)) * 2
+}
+
+// PackageHLS re-encodes a video into an HLS ladder of renditions. It returns
+// a directory holding the master playlist, and a directory per rendition with
+// its playlist and segments; the caller removes it.
+func PackageHLS(storyID int, videoPath string, profile Profile) (string, error) {
+	tempDir, err := TempDirectory()
+	if err != nil {
+		return "", err
+	}
+	outputDir := filepath.Join(tempDir, fmt.Sprintf("story_%d_hls", storyID))
+	if err := os.RemoveAll(outputDir); err != nil {
+		return "", err
+	}
+	renditions := hlsRenditions(profile)
+	for i := range renditions {
+		if err := os.MkdirAll(filepath.Join(outputDir, fmt.Sprintf("stream_%d", i)), 0755); err != nil {
+			return "", err
+		}
+	}
+
+	// Split the video once and scale each copy for its rendition
+	graph := []string{fmt.Sprintf("[0:v]split=%d%s", len(renditions), labels("v", len(renditions)))}
+	args := []string{"-y", "-i", videoPath}
+	var streamMap []string
+	for i, r := range renditions {
+		graph = append(graph, fmt.Sprintf("[v%d]scale=%d:%d[v%dout]", i, r.Width, r.Height, i))
+		args = append(args,
+			"-map", fmt.Sprintf("[v%dout]", i),
+			fmt.Sprintf("-c:v:%d", i), "libx264",
+			fmt.Sprintf("-b:v:%d", i), fmt.Sprintf("%dk", r.VideoBitrate),
+			fmt.Sprintf("-maxrate:v:%d", i), fmt.Sprintf("%dk", r.VideoBitrate*107/100),
+			fmt.Sprintf("-bufsize:v:%d", i), fmt.Sprintf("%dk", r.VideoBitrate*3/2),
+			"-map", "0:a",
+			fmt.Sprintf("-c:a:%d", i), "aac",
+			fmt.Sprintf("-b:a:%d", i), "128k",
+		)
+		streamMap = append(streamMap, fmt.Sprintf("v:%d,a:%d", i, i))
+	}
+	args = append([]string{"-filter_complex", strings.Join(graph, ";")}, args...)
+	args = append(args,
+		"-preset", "veryfast",
+		"-pix_fmt", "yuv420p",
+		// Keyframes on segment boundaries, whatever the frame rate, so players can switch renditions cleanly
+		"-force_key_frames", fmt.Sprintf("expr:gte(t,n_forced*%d)", hlsSegmentSeconds),
+		"-sc_threshold", "0",
+		"-f", "hls",
+		"-hls_time", fmt.Sprintf("%d", hlsSegmentSeconds),
+		"-hls_playlist_type", "vod",
+		"-hls_segment_filename", filepath.Join(outputDir, "stream_%v", "segment_%03d.ts"),
+		"-master_pl_name", HLSMasterPlaylist,
+		"-var_stream_map", strings.Join(streamMap, " "),
+		filepath.Join(outputDir, "stream_%v", "playlist.m3u8"),
+	)
+
+	ffmpegCmd := exec.Command("ffmpeg", args...)
+	var stderr bytes.Buffer
+	ffmpegCmd.Stderr = &stderr
+	if err := ffmpegCmd.Run(); err != nil {
+		log.Printf("FFmpeg HLS error for story %d: %v, Details: %s", storyID, err, stderr.String())
+		os.RemoveAll(outputDir)
+		return "", err
+	}
+
+	return outputDir, nil
+}
+
+// labels returns n filter graph labels such as [v0][v1]
+func labels(prefix string, n int) string {
+	var b strings.Builder
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(&b, "[%s%d]", prefix, i)
+	}
+	return b.String()
+}
+
+// RewritePlaylist replaces every URI line of an HLS playlist with what link
+// returns for it, leaving tags and comments alone
+func RewritePlaylist(playlist []byte, link func(uri string) (string, error)) ([]byte, error) {
+	lines := strings.Split(string(playlist), "\n")
+	for i, line := range lines {
+		uri := strings.TrimSpace(line)
+		if uri == "" || strings.HasPrefix(uri, "#") {
+			continue
+		}
+		rewritten, err := link(uri)
+		if err != nil {
+			return nil, err
+		}
+		lines[i] = rewritten
+	}
+	return []byte(strings.Join(lines, "\n")), nil
+}
@@ -0,0 +1,53 @@
+package misc
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestHLSRenditions(t *testing.T) {
+	tests := []struct {
+		profile string
+		want    []hlsRendition
+	}{
+		{"landscape-1080", []hlsRendition{{1920, 1080, 5000}, {1280, 720, 2800}, {854, 480, 1400}, {640, 360, 800}}},
+		{"vertical-1080", []hlsRendition{{1080, 1920, 5000}, {720, 1280, 2800}, {480, 854, 1400}, {360, 640, 800}}},
+		{"square-720", []hlsRendition{{720, 720, 2800}, {480, 480, 1400}, {360, 360, 800}}},
+	}
+	for _, tt := range tests {
+		profiles, err := LookupProfiles([]string{tt.profile})
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := hlsRenditions(profiles[0])
+		if len(got) != len(tt.want) {
+			t.Fatalf("%s: got %d renditions %v, want %v", tt.profile, len(got), got, tt.want)
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("%s rendition %d = %v, want %v", tt.profile, i, got[i], tt.want[i])
+			}
+		}
+	}
+
+	small := hlsRenditions(Profile{Name: "tiny", AspectRatio: "16:9", Width: 320, Height: 180})
+	if len(small) != 1 || small[0] != (hlsRendition{320, 180, 800}) {
+		t.Errorf("small profile renditions = %v, want just the smallest step", small)
+	}
+}
+
+func TestRewritePlaylist(t *testing.T) {
+	playlist := "#EXTM3U\n#EXT-X-VERSION:3\n#EXTINF:4.000000,\nsegment_000.ts\n#EXTINF:2.000000,\nsegment_001.ts\n#EXT-X-ENDLIST\n"
+	got, err := RewritePlaylist([]byte(playlist), func(uri string) (string, error) {
+		return "https://cdn.example/" + uri + "?sig=1", nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := strings.NewReplacer("segment_000.ts", "https://cdn.example/segment_000.ts?sig=1",
+		"segment_001.ts", "https://cdn.example/segment_001.ts?sig=1").Replace(playlist)
+	if string(got) != want {
+		t.Errorf("RewritePlaylist =\n%s\nwant\n%s", got, want)
+	}
+}
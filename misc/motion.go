@@ -0,0 +1,99 @@
+package misc
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Camera motion presets for a segment's still image. "auto" picks one per
+// segment, varying them so consecutive segments don't move the same way.
+const (
+	MotionAuto     = "auto"
+	MotionZoomIn   = "zoom-in"
+	MotionZoomOut  = "zoom-out"
+	MotionPanLeft  = "pan-left"
+	MotionPanRight = "pan-right"
+	MotionPanUp    = "pan-up"
+	MotionTilt     = "tilt" // Tilting down the image
+	MotionShake    = "shake"
+)
+
+// autoMotions is the cycle auto picks from. Shake is left out, it suits
+// particular moments rather than every fourth segment.
+var autoMotions = []string{MotionZoomIn, MotionPanRight, MotionZoomOut, MotionPanLeft, MotionPanUp, MotionTilt}
+
+// Frame rates a clip can be rendered at. 6 fps keeps renders fast, 24 and 30
+// make the motion smooth rather than stepping.
+var frameRates = map[int]bool{6: true, 24: true, 30: true}
+
+const defaultFrameRate = 6
+
+// MotionPresets lists every preset besides auto
+func MotionPresets() []string {
+	return append(append([]string(nil), autoMotions...), MotionShake)
+}
+
+// ValidateMotion reports an unknown motion preset. Empty means auto.
+func ValidateMotion(motion string) error {
+	if motion == "" || motion == MotionAuto || motion == MotionShake {
+		return nil
+	}
+	for _, m := range autoMotions {
+		if motion == m {
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown camera motion %q, expected auto, %s or %s", motion, strings.Join(autoMotions, ", "), MotionShake)
+}
+
+// ValidateFrameRate reports a frame rate clips can't be rendered at. 0 means the default.
+func ValidateFrameRate(fps int) error {
+	if fps != 0 && !frameRates[fps] {
+		return fmt.Errorf("unsupported frame rate %d, expected 6, 24 or 30", fps)
+	}
+	return nil
+}
+
+// ResolveMotion returns the preset for a segment: its own motion if it has
+// one, then the story's, then the automatic pick for its number
+func ResolveMotion(segmentMotion, storyMotion string, number int) string {
+	for _, motion := range []string{segmentMotion, storyMotion} {
+		if motion != "" && motion != MotionAuto {
+			return motion
+		}
+	}
+	if number < 1 {
+		number = 1
+	}
+	return autoMotions[(number-1)%len(autoMotions)]
+}
+
+// zoompanExpressions returns the zoom, x and y expressions for zoompan.
+// Movement is in terms of the output frame number "on" and the clip's
+// frame count, so a preset covers the same ground at any frame rate.
+func zoompanExpressions(motion string, frames, fps int) (z, x, y string) {
+	const centreX, centreY = "iw/2-(iw/zoom/2)", "ih/2-(ih/zoom/2)"
+	progress := fmt.Sprintf("on/%d", frames)
+
+	switch motion {
+	case MotionZoomOut:
+		return fmt.Sprintf("1.2-0.2*%s", progress), centreX, centreY
+	case MotionPanLeft:
+		return "1.15", fmt.Sprintf("(iw-iw/zoom)*(1-%s)", progress), centreY
+	case MotionPanRight:
+		return "1.15", fmt.Sprintf("(iw-iw/zoom)*%s", progress), centreY
+	case MotionPanUp:
+		return "1.15", centreX, fmt.Sprintf("(ih-ih/zoom)*(1-%s)", progress)
+	case MotionTilt:
+		return "1.15", centreX, fmt.Sprintf("(ih-ih/zoom)*%s", progress)
+	case MotionShake:
+		// A slow handheld drift, two out of step sine waves a fraction of the frame wide
+		t := fmt.Sprintf("on/%d", fps)
+		return "1.1",
+			fmt.Sprintf("%s+iw*0.006*sin(2*PI*0.7*%s)", centreX, t),
+			fmt.Sprintf("%s+ih*0.006*sin(2*PI*0.45*%s+1)", centreY, t)
+	default:
+		// The original slow zoom, 0.001 per frame at 6 fps
+		return fmt.Sprintf("1+%.5f*on", 0.006/float64(fps)), centreX, centreY
+	}
+}
@@ -0,0 +1,39 @@
+package misc
+
+import "testing"
+
+func TestResolveMotion(t *testing.T) {
+	tests := []struct {
+		segment, story string
+		number         int
+		expected       string
+	}{
+		{"shake", "pan-left", 1, "shake"},
+		{"", "pan-left", 1, "pan-left"},
+		{"", "auto", 1, "zoom-in"},
+		{"", "", 2, "pan-right"},
+		{"auto", "", len(autoMotions) + 3, "zoom-out"},
+	}
+	for _, tt := range tests {
+		if got := ResolveMotion(tt.segment, tt.story, tt.number); got != tt.expected {
+			t.Errorf("ResolveMotion(%q, %q, %d) = %q, expected %q", tt.segment, tt.story, tt.number, got, tt.expected)
+		}
+	}
+
+	if err := ValidateMotion("barrel-roll"); err == nil {
+		t.Error("Expected error for unknown motion, got nil")
+	}
+	if err := ValidateFrameRate(60); err == nil {
+		t.Error("Expected error for unsupported frame rate, got nil")
+	}
+}
+
+func TestZoomInKeepsItsSpeed(t *testing.T) {
+	// The same zoom per second at 6 fps, the original rate, and at 30 fps
+	if z, _, _ := zoompanExpressions(MotionZoomIn, 60, 6); z != "1+0.00100*on" {
+		t.Errorf("Unexpected 6 fps zoom %q", z)
+	}
+	if z, _, _ := zoompanExpressions(MotionZoomIn, 300, 30); z != "1+0.00020*on" {
+		t.Errorf("Unexpected 30 fps zoom %q", z)
+	}
+}
@@ -0,0 +1,135 @@
+package misc
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	posterTitleSize  = 26
+	maxTitleChars    = 60
+	previewStart     = 1 // Seconds in, past any fade from black
+	previewSeconds   = 3
+	previewFrameRate = 10
+	previewWidth     = 320
+)
+
+// DefaultTitle makes a title from a story's opening, for stories submitted without one
+func DefaultTitle(content string) string {
+	title := strings.TrimSpace(content)
+	if end := strings.IndexAny(title, ".!?\n"); end >= 0 {
+		title = title[:end]
+	}
+	title = strings.Join(strings.Fields(title), " ")
+	if utf8.RuneCountInString(title) <= maxTitleChars {
+		return title
+	}
+
+	// Cut at the last whole word that fits
+	runes := []rune(title)[:maxTitleChars]
+	if space := strings.LastIndex(string(runes), " "); space > 0 {
+		return string(runes)[:space] + "…"
+	}
+	return string(runes) + "…"
+}
+
+// RenderPoster draws the title over an image, cropped to the profile's frame,
+// and saves it as a JPEG
+func RenderPoster(storyID int, image []byte, title string, profile Profile) (string, error) {
+	profile = profileOrDefault(profile)
+	tempDir, err := TempDirectory()
+	if err != nil {
+		return "", err
+	}
+
+	// The title is drawn with libass, like the burned-in captions
+	titlePath := filepath.Join(tempDir, fmt.Sprintf("story_%d_title.ass", storyID))
+	titleFile, err := os.Create(titlePath)
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(titlePath)
+	style := CaptionStyle{Size: posterTitleSize, Width: profile.Width, Height: profile.Height}
+	if err := WriteASS(titleFile, []Cue{{Start: 0, End: 60, Text: title}}, style); err != nil {
+		titleFile.Close()
+		return "", err
+	}
+	if err := titleFile.Close(); err != nil {
+		return "", err
+	}
+
+	posterPath := filepath.Join(tempDir, fmt.Sprintf("story_%d_poster.jpg", storyID))
+	ffmpegCmd := exec.Command("ffmpeg",
+		"-y",
+		"-f", "image2pipe",
+		"-i", "pipe:0",
+		"-vf", fmt.Sprintf("scale=%[1]d:%[2]d:force_original_aspect_ratio=increase,setsar=1:1,crop=%[1]d:%[2]d,subtitles=filename='%[3]s'",
+			profile.Width, profile.Height, titlePath),
+		"-frames:v", "1",
+		"-q:v", "3",
+		posterPath,
+	)
+	ffmpegCmd.Stdin = bytes.NewReader(image)
+
+	var stderr bytes.Buffer
+	ffmpegCmd.Stderr = &stderr
+	if err := ffmpegCmd.Run(); err != nil {
+		log.Printf("FFmpeg poster error for story %d: %v, Details: %s", storyID, err, stderr.String())
+		return "", err
+	}
+	return posterPath, nil
+}
+
+// RenderPreview cuts a few silent seconds from the video into a small looping
+// animation, in webp or gif format
+func RenderPreview(storyID int, videoPath, format string) (string, error) {
+	tempDir, err := TempDirectory()
+	if err != nil {
+		return "", err
+	}
+
+	scale := fmt.Sprintf("fps=%d,scale=%d:-2:flags=lanczos", previewFrameRate, previewWidth)
+	var args []string
+	switch format {
+	case "webp":
+		args = []string{"-vf", scale, "-c:v", "libwebp", "-quality", "60", "-loop", "0"}
+	case "gif":
+		// Build a palette from the clip itself, GIF's default palette bands badly in the dark
+		args = []string{"-filter_complex", scale + ",split[a][b];[a]palettegen=max_colors=128[p];[b][p]paletteuse=dither=bayer", "-loop", "0"}
+	default:
+		return "", fmt.Errorf("unknown preview format %q, expected webp or gif", format)
+	}
+
+	duration, err := ProbeDuration(videoPath)
+	if err != nil {
+		return "", fmt.Errorf("probing video: %w", err)
+	}
+	start := float64(previewStart)
+	if duration < start+previewSeconds {
+		start = 0
+	}
+
+	previewPath := filepath.Join(tempDir, fmt.Sprintf("story_%d_preview.%s", storyID, format))
+	ffmpegArgs := append([]string{
+		"-y",
+		"-ss", fmt.Sprintf("%.2f", start),
+		"-t", fmt.Sprintf("%d", previewSeconds),
+		"-i", videoPath,
+		"-an",
+	}, args...)
+	ffmpegCmd := exec.Command("ffmpeg", append(ffmpegArgs, previewPath)...)
+
+	var stderr bytes.Buffer
+	ffmpegCmd.Stderr = &stderr
+	if err := ffmpegCmd.Run(); err != nil {
+		log.Printf("FFmpeg preview error for story %d: %v, Details: %s", storyID, err, stderr.String())
+		return "", err
+	}
+	return previewPath, nil
+}
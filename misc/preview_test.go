@@ -0,0 +1,16 @@
+package misc
+
+import "testing"
+
+func TestDefaultTitle(t *testing.T) {
+	tests := map[string]string{
+		"  The house on  Elm Street. It was old.":                                                "The house on Elm Street",
+		"Nobody came back\nfrom the woods":                                                       "Nobody came back",
+		"It was a long, long night and the candles burned lower and lower while the wind howled": "It was a long, long night and the candles burned lower and…",
+	}
+	for content, expected := range tests {
+		if got := DefaultTitle(content); got != expected {
+			t.Errorf("DefaultTitle(%q) = %q, expected %q", content, got, expected)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package misc
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Profile is an output format for a story's video. Its aspect ratio is also
+// what the images are generated at.
+type Profile struct {
+	Name        string
+	AspectRatio string
+	Width       int
+	Height      int
+}
+
+// DefaultProfile is the original landscape render
+var DefaultProfile = profiles["landscape"]
+
+var profiles = map[string]Profile{
+	"landscape":      {Name: "landscape", AspectRatio: "16:9", Width: 1344, Height: 768},
+	"landscape-720":  {Name: "landscape-720", AspectRatio: "16:9", Width: 1280, Height: 720},
+	"landscape-1080": {Name: "landscape-1080", AspectRatio: "16:9", Width: 1920, Height: 1080},
+	"vertical":       {Name: "vertical", AspectRatio: "9:16", Width: 768, Height: 1344},
+	"vertical-720":   {Name: "vertical-720", AspectRatio: "9:16", Width: 720, Height: 1280},
+	"vertical-1080":  {Name: "vertical-1080", AspectRatio: "9:16", Width: 1080, Height: 1920},
+	"square":         {Name: "square", AspectRatio: "1:1", Width: 1024, Height: 1024},
+	"square-720":     {Name: "square-720", AspectRatio: "1:1", Width: 720, Height: 720},
+	"square-1080":    {Name: "square-1080", AspectRatio: "1:1", Width: 1080, Height: 1080},
+}
+
+// LookupProfiles returns the named profiles in order, without repeats. No
+// names means just the default profile.
+func LookupProfiles(names []string) ([]Profile, error) {
+	if len(names) == 0 {
+		return []Profile{DefaultProfile}, nil
+	}
+
+	var found []Profile
+	seen := make(map[string]bool)
+	for _, name := range names {
+		profile, ok := profiles[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown output profile %q, expected one of %s", name, strings.Join(ProfileNames(), ", "))
+		}
+		if !seen[name] {
+			seen[name] = true
+			found = append(found, profile)
+		}
+	}
+	return found, nil
+}
+
+// ProfileNames lists every profile name, sorted
+func ProfileNames() []string {
+	names := make([]string, 0, len(profiles))
+	for name := range profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// profileOrDefault fills in the default for a zero profile
+func profileOrDefault(p Profile) Profile {
+	if p.Width == 0 || p.Height == 0 {
+		return DefaultProfile
+	}
+	return p
+}
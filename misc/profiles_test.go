@@ -0,0 +1,22 @@
+package misc
+
+import "testing"
+
+func TestLookupProfiles(t *testing.T) {
+	profiles, err := LookupProfiles(nil)
+	if err != nil || len(profiles) != 1 || profiles[0] != DefaultProfile {
+		t.Errorf("Expected just the default profile, got %v (%v)", profiles, err)
+	}
+
+	profiles, err = LookupProfiles([]string{"vertical-1080", "square", "vertical-1080"})
+	if err != nil {
+		t.Fatalf("Expected success, got error: %v", err)
+	}
+	if len(profiles) != 2 || profiles[0].Width != 1080 || profiles[0].Height != 1920 || profiles[1].AspectRatio != "1:1" {
+		t.Errorf("Unexpected profiles %v", profiles)
+	}
+
+	if _, err := LookupProfiles([]string{"imax"}); err == nil {
+		t.Error("Expected error for unknown profile, got nil")
+	}
+}
@@ -0,0 +1,312 @@
+package misc
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/1rvyn/halloween-story-generator/models"
+)
+
+const (
+	captionLineChars = 42 // Longest caption line, the usual broadcast limit
+	captionLines     = 2  // Lines shown at once
+)
+
+// Cue is one caption, shown from Start to End seconds into the video
+type Cue struct {
+	Start float64
+	End   float64
+	Text  string        // Lines are separated by \n
+	Words []models.Word // When each word of Text is spoken, in seconds into the video, if known
+}
+
+// captionChunk is a run of words shown together, fields[first:last]
+type captionChunk struct {
+	first, last int
+	text        string
+}
+
+// chunkWords breaks words into captions short enough to read
+func chunkWords(fields []string) []captionChunk {
+	var chunks []captionChunk
+	var lines []string
+	line, first := "", 0
+	for i, word := range fields {
+		if line != "" && len(line)+1+len(word) > captionLineChars {
+			lines = append(lines, line)
+			line = ""
+			if len(lines) == captionLines {
+				chunks = append(chunks, captionChunk{first: first, last: i, text: strings.Join(lines, "\n")})
+				lines, first = nil, i
+			}
+		}
+		if line != "" {
+			line += " "
+		}
+		line += word
+	}
+	if line != "" {
+		lines = append(lines, line)
+	}
+	if len(lines) > 0 {
+		chunks = append(chunks, captionChunk{first: first, last: len(fields), text: strings.Join(lines, "\n")})
+	}
+	return chunks
+}
+
+// SegmentCues breaks a segment's text into captions short enough to read.
+// With word timings each caption shows from when its first word is spoken,
+// otherwise captions are spread over the segment in proportion to their length.
+func SegmentCues(text string, start, duration float64, words []models.Word) []Cue {
+	fields := strings.Fields(text)
+	chunks := chunkWords(fields)
+	if len(words) != len(fields) {
+		words = nil
+	}
+
+	total := 0
+	for _, chunk := range chunks {
+		total += len(chunk.text)
+	}
+
+	cues := make([]Cue, len(chunks))
+	at, seen := start, 0
+	for i, chunk := range chunks {
+		seen += len(chunk.text)
+		end := start + duration*float64(seen)/float64(total)
+
+		if words != nil {
+			if i+1 < len(chunks) {
+				end = start + words[chunks[i+1].first].Start
+			} else {
+				end = start + duration
+			}
+			cues[i].Words = make([]models.Word, 0, chunk.last-chunk.first)
+			for _, w := range words[chunk.first:chunk.last] {
+				cues[i].Words = append(cues[i].Words, models.Word{Text: w.Text, Start: start + w.Start, End: start + w.End})
+			}
+		}
+
+		cues[i].Start, cues[i].End, cues[i].Text = at, end, chunk.text
+		at = end
+	}
+	return cues
+}
+
+// StoryCues captions every segment, given when each segment's clip starts
+// in the video and how long it runs
+func StoryCues(segments []models.Segment, starts, durations []float64) []Cue {
+	var cues []Cue
+	for i, seg := range segments {
+		cues = append(cues, SegmentCues(seg.Segment, starts[i], durations[i], seg.Words)...)
+	}
+	return cues
+}
+
+// WriteSRT writes cues in SubRip format
+func WriteSRT(w io.Writer, cues []Cue) error {
+	for i, cue := range cues {
+		if _, err := fmt.Fprintf(w, "%d\n%s --> %s\n%s\n\n",
+			i+1, cueTimestamp(cue.Start, ","), cueTimestamp(cue.End, ","), cue.Text); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteVTT writes cues in WebVTT format. Word timings become inline
+// timestamps, which players use to highlight each word as it is spoken.
+func WriteVTT(w io.Writer, cues []Cue) error {
+	if _, err := io.WriteString(w, "WEBVTT\n\n"); err != nil {
+		return err
+	}
+	for _, cue := range cues {
+		text := cue.Text
+		if len(cue.Words) > 0 {
+			text = timedLines(cue, "\n", func(word models.Word, i int) string {
+				if i == 0 {
+					return word.Text
+				}
+				return "<" + cueTimestamp(word.Start, ".") + ">" + word.Text
+			})
+		}
+		if _, err := fmt.Fprintf(w, "%s --> %s\n%s\n\n",
+			cueTimestamp(cue.Start, "."), cueTimestamp(cue.End, "."), text); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// timedLines rebuilds a cue's lines from its words, formatting each word with
+// its index in the cue
+func timedLines(cue Cue, lineBreak string, format func(word models.Word, i int) string) string {
+	var out strings.Builder
+	i := 0
+	for n, line := range strings.Split(cue.Text, "\n") {
+		if n > 0 {
+			out.WriteString(lineBreak)
+		}
+		for m := range strings.Fields(line) {
+			if i >= len(cue.Words) {
+				break
+			}
+			if m > 0 {
+				out.WriteString(" ")
+			}
+			out.WriteString(format(cue.Words[i], i))
+			i++
+		}
+	}
+	return out.String()
+}
+
+// cueTimestamp formats seconds as hh:mm:ss followed by milliseconds. SRT
+// separates the milliseconds with a comma, WebVTT with a dot.
+func cueTimestamp(seconds float64, sep string) string {
+	ms := int64(math.Round(seconds * 1000))
+	return fmt.Sprintf("%02d:%02d:%02d%s%03d", ms/3600000, ms/60000%60, ms/1000%60, sep, ms%1000)
+}
+
+// CaptionStyle configures captions burned into the frames, and ASS subtitles
+type CaptionStyle struct {
+	Font     string // Any font fontconfig can find, DejaVu Sans by default
+	Size     int    // Relative to a 288 pixel tall frame, as libass scales subtitles
+	Position string // bottom (default), middle or top
+	Karaoke  bool   // Highlight each word as it is spoken, when word timings are known
+	Width    int    // Frame size the captions are laid out for, 0 for 16:9
+	Height   int
+}
+
+// captionAlignments are the ASS numpad alignments for each position
+var captionAlignments = map[string]int{
+	"":       2,
+	"bottom": 2,
+	"middle": 5,
+	"top":    8,
+}
+
+// Validate reports settings the subtitles filter can't use
+func (s CaptionStyle) Validate() error {
+	if _, ok := captionAlignments[s.Position]; !ok {
+		return fmt.Errorf("unknown caption position %q, expected bottom, middle or top", s.Position)
+	}
+	if s.Size < 0 {
+		return fmt.Errorf("caption size must be positive")
+	}
+	if strings.ContainsAny(s.Font, ",:'\\[];=\n") {
+		return fmt.Errorf("caption font %q contains characters ffmpeg can't take", s.Font)
+	}
+	return nil
+}
+
+// WriteASS writes cues as an Advanced SubStation Alpha script. Karaoke styles
+// use \k tags so each word changes from white to orange as it is spoken.
+func WriteASS(w io.Writer, cues []Cue, style CaptionStyle) error {
+	font, size := style.Font, style.Size
+	if font == "" {
+		font = "DejaVu Sans"
+	}
+	if size == 0 {
+		size = 18
+	}
+	alignment := captionAlignments[style.Position]
+
+	// Keep libass's usual 288 line script height, with the width following
+	// the frame so text isn't stretched on other aspect ratios
+	playResX := 384
+	if style.Width > 0 && style.Height > 0 {
+		playResX = 288 * style.Width / style.Height
+	}
+
+	// Colours are &HAABBGGRR. Karaoke text starts in the secondary colour and
+	// switches to the primary colour as each word is spoken.
+	header := fmt.Sprintf("[Script Info]\nScriptType: v4.00+\nPlayResX: %d\nPlayResY: 288\nWrapStyle: 0\n\n", playResX) +
+		"[V4+ Styles]\n" +
+		"Format: Name, Fontname, Fontsize, PrimaryColour, SecondaryColour, OutlineColour, BackColour, Bold, Italic, Underline, StrikeOut, ScaleX, ScaleY, Spacing, Angle, BorderStyle, Outline, Shadow, Alignment, MarginL, MarginR, MarginV, Encoding\n" +
+		fmt.Sprintf("Style: Default,%s,%d,&H00FFFFFF,&H00FFFFFF,&H00000000,&H80000000,0,0,0,0,100,100,0,0,1,2,0,%d,20,20,20,1\n", font, size, alignment) +
+		fmt.Sprintf("Style: Karaoke,%s,%d,&H0000A5FF,&H00FFFFFF,&H00000000,&H80000000,0,0,0,0,100,100,0,0,1,2,0,%d,20,20,20,1\n\n", font, size, alignment) +
+		"[Events]\nFormat: Layer, Start, End, Style, Name, MarginL, MarginR, MarginV, Effect, Text\n"
+	if _, err := io.WriteString(w, header); err != nil {
+		return err
+	}
+
+	for _, cue := range cues {
+		styleName, text := "Default", strings.ReplaceAll(assEscape(cue.Text), "\n", `\N`)
+		if style.Karaoke && len(cue.Words) > 0 {
+			styleName, text = "Karaoke", karaokeText(cue)
+		}
+		if _, err := fmt.Fprintf(w, "Dialogue: 0,%s,%s,%s,,0,0,0,,%s\n",
+			assTimestamp(cue.Start), assTimestamp(cue.End), styleName, text); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// karaokeText tags each word with how long, in centiseconds, until the next
+// word starts. Any wait before the first word is an empty syllable.
+func karaokeText(cue Cue) string {
+	lead := ""
+	if wait := centiseconds(cue.Words[0].Start - cue.Start); wait > 0 {
+		lead = fmt.Sprintf(`{\k%d}`, wait)
+	}
+	return lead + timedLines(cue, `\N`, func(word models.Word, i int) string {
+		next := cue.End
+		if i+1 < len(cue.Words) {
+			next = cue.Words[i+1].Start
+		}
+		return fmt.Sprintf(`{\k%d}%s`, centiseconds(next-word.Start), assEscape(word.Text))
+	})
+}
+
+func centiseconds(seconds float64) int {
+	if seconds <= 0 {
+		return 0
+	}
+	return int(math.Round(seconds * 100))
+}
+
+// assEscape keeps text from being read as override tags
+func assEscape(text string) string {
+	return strings.NewReplacer("{", "(", "}", ")", `\`, "/").Replace(text)
+}
+
+// assTimestamp formats seconds as h:mm:ss.cc
+func assTimestamp(seconds float64) string {
+	cs := int64(math.Round(seconds * 100))
+	return fmt.Sprintf("%d:%02d:%02d.%02d", cs/360000, cs/6000%60, cs/100%60, cs%100)
+}
+
+// captionFilter writes a segment's captions to a temporary ASS script and
+// returns the subtitles filter that burns them in, along with the file to
+// remove once the clip is rendered.
+func captionFilter(style CaptionStyle, profile Profile, storyID, idx int, segment models.Segment, duration float64) (string, string, error) {
+	tempDir, err := TempDirectory()
+	if err != nil {
+		return "", "", err
+	}
+	style.Width, style.Height = profile.Width, profile.Height
+
+	assPath := filepath.Join(tempDir, fmt.Sprintf("story_%d_segment_%d_%s.ass", storyID, idx+1, profile.Name))
+	file, err := os.Create(assPath)
+	if err != nil {
+		return "", "", err
+	}
+	if err := WriteASS(file, SegmentCues(segment.Segment, 0, duration, segment.Words), style); err != nil {
+		file.Close()
+		os.Remove(assPath)
+		return "", "", err
+	}
+	if err := file.Close(); err != nil {
+		os.Remove(assPath)
+		return "", "", err
+	}
+
+	// The path is under our own temp directory, so it needs no escaping
+	return fmt.Sprintf("subtitles=filename='%s'", assPath), assPath, nil
+}
@@ -0,0 +1,127 @@
+package misc
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/1rvyn/halloween-story-generator/models"
+)
+
+func TestSegmentCues(t *testing.T) {
+	text := "The lights flickered as the old house groaned. Something moved upstairs, slow and deliberate, and then everything went quiet."
+	cues := SegmentCues(text, 10, 8, nil)
+
+	if len(cues) < 2 {
+		t.Fatalf("Expected the text to be split into several cues, got %d", len(cues))
+	}
+	if cues[0].Start != 10 || cues[len(cues)-1].End != 18 {
+		t.Errorf("Expected cues to span 10s to 18s, got %.3f to %.3f", cues[0].Start, cues[len(cues)-1].End)
+	}
+
+	var words []string
+	for i, cue := range cues {
+		if i > 0 && cue.Start != cues[i-1].End {
+			t.Errorf("Cue %d starts at %.3f, expected %.3f", i, cue.Start, cues[i-1].End)
+		}
+		lines := strings.Split(cue.Text, "\n")
+		if len(lines) > captionLines {
+			t.Errorf("Cue %d has %d lines", i, len(lines))
+		}
+		for _, line := range lines {
+			if len(line) > captionLineChars {
+				t.Errorf("Line %q is longer than %d characters", line, captionLineChars)
+			}
+			words = append(words, strings.Fields(line)...)
+		}
+	}
+	if strings.Join(words, " ") != text {
+		t.Errorf("Cues lost words: %q", strings.Join(words, " "))
+	}
+}
+
+func TestWriteSubtitles(t *testing.T) {
+	segments := []models.Segment{{Segment: "It was a dark night."}, {Segment: "Then the door opened."}}
+	cues := StoryCues(segments, []float64{0, 2.5}, []float64{2.5, 3661.25})
+
+	var srt bytes.Buffer
+	if err := WriteSRT(&srt, cues); err != nil {
+		t.Fatal(err)
+	}
+	expected := "1\n00:00:00,000 --> 00:00:02,500\nIt was a dark night.\n\n" +
+		"2\n00:00:02,500 --> 01:01:03,750\nThen the door opened.\n\n"
+	if srt.String() != expected {
+		t.Errorf("Unexpected SRT:\n%s", srt.String())
+	}
+
+	var vtt bytes.Buffer
+	if err := WriteVTT(&vtt, cues); err != nil {
+		t.Fatal(err)
+	}
+	expected = "WEBVTT\n\n00:00:00.000 --> 00:00:02.500\nIt was a dark night.\n\n" +
+		"00:00:02.500 --> 01:01:03.750\nThen the door opened.\n\n"
+	if vtt.String() != expected {
+		t.Errorf("Unexpected WebVTT:\n%s", vtt.String())
+	}
+}
+
+func TestKaraokeSubtitles(t *testing.T) {
+	segments := []models.Segment{
+		{Segment: "Skip this.", Words: []models.Word{{Text: "Skip", Start: 0, End: 0.4}, {Text: "this.", Start: 0.5, End: 1}}},
+		{Segment: "Who is there?", Words: []models.Word{
+			{Text: "Who", Start: 0.25, End: 0.5},
+			{Text: "is", Start: 0.5, End: 0.75},
+			{Text: "there?", Start: 0.75, End: 1.5},
+		}},
+	}
+	cues := StoryCues(segments, []float64{0, 1}, []float64{1, 2})
+	if len(cues) != 2 {
+		t.Fatalf("Expected 2 cues, got %d", len(cues))
+	}
+	cue := cues[1]
+	if cue.Start != 1 || cue.End != 3 || cue.Words[0].Start != 1.25 {
+		t.Errorf("Expected word timings offset by the first segment, got %+v", cue)
+	}
+
+	var vtt bytes.Buffer
+	if err := WriteVTT(&vtt, cues[1:]); err != nil {
+		t.Fatal(err)
+	}
+	expected := "WEBVTT\n\n00:00:01.000 --> 00:00:03.000\nWho <00:00:01.500>is <00:00:01.750>there?\n\n"
+	if vtt.String() != expected {
+		t.Errorf("Unexpected WebVTT:\n%s", vtt.String())
+	}
+
+	var ass bytes.Buffer
+	if err := WriteASS(&ass, cues[1:], CaptionStyle{Karaoke: true}); err != nil {
+		t.Fatal(err)
+	}
+	expected = `Dialogue: 0,0:00:01.00,0:00:03.00,Karaoke,,0,0,0,,{\k25}{\k25}Who {\k25}is {\k125}there?`
+	if !strings.Contains(ass.String(), expected) {
+		t.Errorf("Expected ASS to contain %q, got:\n%s", expected, ass.String())
+	}
+}
+
+func TestParseSilences(t *testing.T) {
+	output := []byte(`[silencedetect @ 0x1] silence_start: -0.0123
+[silencedetect @ 0x1] silence_end: 0.41 | silence_duration: 0.42
+size=N/A time=00:00:03.00 bitrate=N/A speed= 600x
+[silencedetect @ 0x1] silence_start: 2.5
+`)
+	silences := parseSilences(output)
+	if len(silences) != 2 || silences[0].End != 0.41 || silences[1].Start != 2.5 || silences[1].End < 3 {
+		t.Errorf("Unexpected silences %+v", silences)
+	}
+}
+
+func TestCaptionStyleValidate(t *testing.T) {
+	if err := (CaptionStyle{Font: "DejaVu Serif", Size: 24, Position: "top"}).Validate(); err != nil {
+		t.Errorf("Expected valid style, got %v", err)
+	}
+	if err := (CaptionStyle{Position: "sideways"}).Validate(); err == nil {
+		t.Error("Expected error for unknown position, got nil")
+	}
+	if err := (CaptionStyle{Font: "Evil',drawtext=text='x"}).Validate(); err == nil {
+		t.Error("Expected error for font that would break the filter graph, got nil")
+	}
+}
@@ -0,0 +1,116 @@
+package misc
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Transition is how one segment's clip gives way to the next
+type Transition struct {
+	Name     string  // cut (default), crossfade, fadeblack, wipe or glitch
+	Duration float64 // Seconds, 0 for the default
+}
+
+const (
+	defaultTransitionSeconds = 0.5
+	maxTransitionSeconds     = 3
+)
+
+// glitchExpr is an xfade custom transition that swaps horizontal bands
+// between the clips in a flickering pattern. P runs from 1 down to 0.
+const glitchExpr = "if(gt(mod(floor(Y/32)*37+floor(P*12)*91,17)/17,P),B,A)"
+
+// xfadeTransitions maps transition names to xfade filter options
+var xfadeTransitions = map[string]string{
+	"crossfade": "transition=fade",
+	"fadeblack": "transition=fadeblack",
+	"wipe":      "transition=wipeleft",
+	"glitch":    "transition=custom:expr='" + glitchExpr + "'",
+}
+
+// Validate reports unknown transitions and unreasonable lengths
+func (t Transition) Validate() error {
+	if _, ok := xfadeTransitions[t.Name]; !ok && !t.isCut() {
+		return fmt.Errorf("unknown transition %q, expected cut, crossfade, fadeblack, wipe or glitch", t.Name)
+	}
+	if t.Duration < 0 || t.Duration > maxTransitionSeconds {
+		return fmt.Errorf("transition length must be between 0 and %d seconds", maxTransitionSeconds)
+	}
+	return nil
+}
+
+func (t Transition) isCut() bool {
+	return t.Name == "" || t.Name == "cut"
+}
+
+func (t Transition) seconds() float64 {
+	if t.isCut() {
+		return 0
+	}
+	if t.Duration == 0 {
+		return defaultTransitionSeconds
+	}
+	return t.Duration
+}
+
+// NarrationStarts returns when each clip's narration starts in the joined
+// video. Clips are padded with held frames and silence on the sides that
+// transition, so the overlap never eats into the narration; each transition
+// adds its length to the video.
+func NarrationStarts(durations []float64, t Transition) []float64 {
+	starts := make([]float64, len(durations))
+	at := 0.0
+	for i, duration := range durations {
+		starts[i] = at
+		at += duration + t.seconds()
+	}
+	return starts
+}
+
+// transitionFilter builds the filter graph joining the clips with t, along
+// with the labels of its video and audio outputs
+func transitionFilter(durations []float64, t Transition) (string, string, string) {
+	d := t.seconds()
+	n := len(durations)
+
+	var graph []string
+	for i, duration := range durations {
+		length := duration
+		var video, audio []string
+		if i > 0 {
+			video = append(video, fmt.Sprintf("tpad=start_mode=clone:start_duration=%.3f", d))
+			audio = append(audio, fmt.Sprintf("adelay=%d:all=1", int(d*1000)))
+			length += d
+		}
+		if i < n-1 {
+			video = append(video, fmt.Sprintf("tpad=stop_mode=clone:stop_duration=%.3f", d))
+			length += d
+		}
+		video = append(video, "settb=AVTB")
+		audio = append(audio, fmt.Sprintf("apad=whole_dur=%.3f", length), fmt.Sprintf("atrim=0:%.3f", length))
+
+		graph = append(graph,
+			fmt.Sprintf("[%d:v]%s[v%d]", i, strings.Join(video, ","), i),
+			fmt.Sprintf("[%d:a]%s[a%d]", i, strings.Join(audio, ","), i),
+		)
+	}
+
+	// Each join overlaps the padding at the end of what has been joined so far
+	// with the padding at the start of the next clip
+	videoOut, audioOut := "v0", "a0"
+	joined := durations[0] + d
+	for i := 1; i < n; i++ {
+		next := durations[i] + d
+		if i < n-1 {
+			next += d
+		}
+		graph = append(graph,
+			fmt.Sprintf("[%s][v%d]xfade=%s:duration=%.3f:offset=%.3f[vx%d]", videoOut, i, xfadeTransitions[t.Name], d, joined-d, i),
+			fmt.Sprintf("[%s][a%d]acrossfade=d=%.3f[ax%d]", audioOut, i, d, i),
+		)
+		videoOut, audioOut = fmt.Sprintf("vx%d", i), fmt.Sprintf("ax%d", i)
+		joined += next - d
+	}
+
+	return strings.Join(graph, ";"), "[" + videoOut + "]", "[" + audioOut + "]"
+}
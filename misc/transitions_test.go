@@ -0,0 +1,49 @@
+package misc
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestTransitionTimeline(t *testing.T) {
+	durations := []float64{4, 3, 5}
+	crossfade := Transition{Name: "crossfade", Duration: 1}
+
+	if starts := NarrationStarts(durations, crossfade); !reflect.DeepEqual(starts, []float64{0, 5, 9}) {
+		t.Errorf("Unexpected narration starts %v", starts)
+	}
+	if starts := NarrationStarts(durations, Transition{}); !reflect.DeepEqual(starts, []float64{0, 4, 7}) {
+		t.Errorf("Unexpected narration starts for cuts %v", starts)
+	}
+
+	graph, videoOut, audioOut := transitionFilter(durations, crossfade)
+	for _, expected := range []string{
+		"[0:v]tpad=stop_mode=clone:stop_duration=1.000,settb=AVTB[v0]",
+		"[1:a]adelay=1000:all=1,apad=whole_dur=5.000,atrim=0:5.000[a1]",
+		// Clip 0 is 5s with its padding, clip 1 is 5s with padding on both sides
+		"[v0][v1]xfade=transition=fade:duration=1.000:offset=4.000[vx1]",
+		"[vx1][v2]xfade=transition=fade:duration=1.000:offset=8.000[vx2]",
+		"[ax1][a2]acrossfade=d=1.000[ax2]",
+	} {
+		if !strings.Contains(graph, expected) {
+			t.Errorf("Expected filter graph to contain %q, got %s", expected, graph)
+		}
+	}
+	if videoOut != "[vx2]" || audioOut != "[ax2]" {
+		t.Errorf("Unexpected outputs %s %s", videoOut, audioOut)
+	}
+}
+
+func TestTransitionValidate(t *testing.T) {
+	for _, valid := range []Transition{{}, {Name: "cut"}, {Name: "glitch", Duration: 0.25}} {
+		if err := valid.Validate(); err != nil {
+			t.Errorf("Expected %+v to be valid, got %v", valid, err)
+		}
+	}
+	for _, invalid := range []Transition{{Name: "star-wipe"}, {Name: "crossfade", Duration: 10}} {
+		if err := invalid.Validate(); err == nil {
+			t.Errorf("Expected %+v to be invalid", invalid)
+		}
+	}
+}
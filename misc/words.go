@@ -0,0 +1,108 @@
+package misc
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/1rvyn/halloween-story-generator/models"
+	"github.com/1rvyn/halloween-story-generator/narrator"
+)
+
+var (
+	silenceStartPattern = regexp.MustCompile(`silence_start: (-?[0-9.]+)`)
+	silenceEndPattern   = regexp.MustCompile(`silence_end: (-?[0-9.]+)`)
+)
+
+// WordTimings finds when each word is spoken in narration from a backend that
+// doesn't report it, using narrator.DefaultAligner. Without an aligner, or if
+// it fails, the timings are estimated instead.
+func WordTimings(text, audioPath string, duration float64) []models.Word {
+	if narrator.DefaultAligner != nil {
+		words, err := alignWords(text, audioPath)
+		if err == nil {
+			return words
+		}
+		log.Printf("Warning: Failed to align words in %s, estimating them instead: %v", audioPath, err)
+	}
+	return EstimateWordTimings(text, audioPath, duration)
+}
+
+func alignWords(text, audioPath string) ([]models.Word, error) {
+	audio, err := os.ReadFile(audioPath)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+	return narrator.DefaultAligner.Align(ctx, text, audio, strings.TrimPrefix(filepath.Ext(audioPath), "."))
+}
+
+// EstimateWordTimings guesses word timings for narration when there is no
+// aligner. It isn't forced alignment: words are fitted around the pauses
+// ffmpeg hears in the audio in proportion to their length, so highlighting
+// can drift within a long phrase without a pause. If the audio can't be
+// analysed the words are spread over the whole duration.
+func EstimateWordTimings(text, audioPath string, duration float64) []models.Word {
+	silences, err := DetectSilences(audioPath)
+	if err != nil {
+		log.Printf("Warning: Failed to detect pauses in %s, estimating word timings from the text: %v", audioPath, err)
+	}
+	return narrator.EstimateWords(text, duration, silences)
+}
+
+// DetectSilences finds the pauses in an audio file using ffmpeg's silencedetect filter
+func DetectSilences(audioPath string) ([]narrator.Span, error) {
+	ffmpegCmd := exec.Command("ffmpeg",
+		"-hide_banner",
+		"-i", audioPath,
+		"-af", "silencedetect=noise=-35dB:d=0.15",
+		"-f", "null",
+		"-",
+	)
+	var stderr bytes.Buffer
+	ffmpegCmd.Stderr = &stderr
+	if err := ffmpegCmd.Run(); err != nil {
+		return nil, err
+	}
+	return parseSilences(stderr.Bytes()), nil
+}
+
+// parseSilences reads the silence_start and silence_end lines silencedetect logs
+func parseSilences(output []byte) []narrator.Span {
+	var silences []narrator.Span
+	open := false
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if m := silenceStartPattern.FindSubmatch(line); m != nil {
+			start, err := strconv.ParseFloat(string(m[1]), 64)
+			if err != nil {
+				continue
+			}
+			silences = append(silences, narrator.Span{Start: start, End: start})
+			open = true
+		} else if m := silenceEndPattern.FindSubmatch(line); m != nil && open {
+			end, err := strconv.ParseFloat(string(m[1]), 64)
+			if err != nil {
+				continue
+			}
+			silences[len(silences)-1].End = end
+			open = false
+		}
+	}
+
+	// Silence running to the end of the file never logs an end
+	if open {
+		silences[len(silences)-1].End = 1e9
+	}
+	return silences
+}
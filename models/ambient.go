@@ -0,0 +1,11 @@
+package models
+
+import "gorm.io/gorm"
+
+// AmbientTrack is a background sound a user uploaded to play under their stories
+type AmbientTrack struct {
+	gorm.Model
+	Name      string `json:"name"`
+	Key       string `json:"-"` // Stored audio
+	CreatedBy int    `json:"created_by"`
+}
@@ -0,0 +1,30 @@
+package models
+
+import "strings"
+
+// StoryBible keeps a story's images consistent with each other: one art
+// style for every image, and a fixed description and seed for each recurring
+// character. It is drawn up when the story is segmented and can be edited.
+type StoryBible struct {
+	ArtStyle   string      `json:"art_style"`
+	Seed       int64       `json:"seed"` // For images without a recurring character
+	Characters []Character `json:"characters"`
+}
+
+// Character is a recurring character, drawn the same way in every image
+type Character struct {
+	Name        string `json:"name"`
+	Description string `json:"description"` // Their look, e.g. a thin man in a grey coat
+	Seed        int64  `json:"seed"`        // For images they appear in, on backends that take a seed
+}
+
+// Character finds a character by name, ignoring case
+func (b *StoryBible) Character(name string) *Character {
+	name = strings.TrimSpace(name)
+	for i := range b.Characters {
+		if strings.EqualFold(b.Characters[i].Name, name) {
+			return &b.Characters[i]
+		}
+	}
+	return nil
+}
@@ -21,14 +21,49 @@ type GroqResponse struct {
 	Segments []SegmentXML `xml:"segment"`
 }
 
+// SegmentJSON is one segment of a JSON mode segmentation
+type SegmentJSON struct {
+	Number       int      `json:"number"`
+	Text         string   `json:"text"`
+	ImagePrompt  string   `json:"image_prompt"`
+	Mood         string   `json:"mood"`
+	Characters   []string `json:"characters"`
+	CameraMotion string   `json:"camera_motion"`
+}
+
+type SegmentationJSON struct {
+	Segments []SegmentJSON `json:"segments"`
+}
+
+// CharacterJSON is a recurring character as the image prompt step describes them
+type CharacterJSON struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+// ImagePromptJSON is the image prompt for one segment
+type ImagePromptJSON struct {
+	Number         int      `json:"number"`
+	Prompt         string   `json:"prompt"`
+	NegativePrompt string   `json:"negative_prompt"`
+	Characters     []string `json:"characters"`
+}
+
+type ImagePromptsJSON struct {
+	ArtStyle   string            `json:"art_style"`
+	Characters []CharacterJSON   `json:"characters"`
+	Segments   []ImagePromptJSON `json:"segments"`
+}
+
 type GroqRequest struct {
-	Messages    []Message   `json:"messages"`
-	Model       string      `json:"model"`
-	Temperature float64     `json:"temperature"`
-	MaxTokens   int         `json:"max_tokens"`
-	TopP        float64     `json:"top_p"`
-	Stream      bool        `json:"stream"`
-	Stop        interface{} `json:"stop"`
+	Messages       []Message   `json:"messages"`
+	Model          string      `json:"model"`
+	Temperature    float64     `json:"temperature"`
+	MaxTokens      int         `json:"max_tokens"`
+	TopP           float64     `json:"top_p"`
+	Stream         bool        `json:"stream"`
+	Stop           interface{} `json:"stop"`
+	ResponseFormat interface{} `json:"response_format,omitempty"` // Asks for JSON, optionally against a schema
 }
 
 // Initialize the prompt, possibly from environment or configuration
@@ -66,3 +101,45 @@ Gathering her courage, Sarah decided to investigate. She grabbed a flashlight an
 
 6. Now, please process the provided story and create appropriate segments. Remember to consider the narrative flow and how each segment might be represented visually in a video.`,
 }
+
+// StorySegmentationJSONInstance is the prompt for JSON mode, where the
+// response format carries the schema and the prompt explains the fields
+var StorySegmentationJSONInstance = StorySegmentation{
+	Prompt: `You are tasked with segmenting a scary story into smaller parts that can be used for narration in a video. Each segment is narrated over a single image or scene.
+
+When creating segments, follow these guidelines:
+   - Each segment should be a coherent part of the story, typically 2-4 sentences long.
+   - Segments should end at natural breaking points in the narrative.
+   - Try to keep segments roughly similar in length, but prioritize narrative coherence over strict length equality.
+   - Every sentence of the story must appear, unchanged and in order, in exactly one segment.
+
+Reply with a JSON object with a "segments" array. Each segment has:
+   - "number": its position, starting at 1
+   - "text": the segment's sentences, exactly as they appear in the story
+   - "image_prompt": a one sentence description of a single static image showing the segment, naming the setting, lighting and what is in frame
+   - "mood": one or two words for the segment's mood, e.g. eerie, tense, terrifying or melancholy
+   - "characters": the names or short descriptions of the characters present, empty if there are none
+   - "camera_motion": how the camera should move over the image, one of zoom-in, zoom-out, pan-left, pan-right, pan-up, tilt or shake (for sudden shocks only)`,
+}
+
+// ImagePromptInstance is the prompt for turning segments into image prompts
+var ImagePromptInstance = StorySegmentation{
+	Prompt: `You write prompts for a text-to-image model that illustrates a scary story narrated over a video, one image per segment.
+
+You will be given the story and its numbered segments as JSON. Some segments may already have a "scene" describing the picture; use it as a starting point. There may also be an "art_style" and "characters" that have already been decided.
+
+1. Choose an art style for the whole story, in a short phrase naming the medium, era and palette that suit its setting and tone, e.g. "1970s horror film still, grainy 35mm, saturated reds and deep shadows" or "Victorian woodcut print, heavy black lines on yellowed paper". If an art style was given, repeat it unchanged.
+
+2. Decide on the recurring characters. Give each a name as the story calls them and a short, concrete visual description: age, build, hair, clothing and any distinguishing features. The same description is used every time the character appears, so keep it specific and neutral about pose and expression. Keep any characters that were given, with their descriptions unchanged.
+
+3. Then, for each segment, write:
+   - "prompt": one or two sentences describing a single static image for the segment: the setting, time of day, lighting, camera angle and what is in frame. Describe what can be seen, not what is heard or thought. Don't describe the art style, and don't describe the characters' appearance, both are added separately.
+   - "negative_prompt": a few comma separated things to keep out of this image that the model might otherwise add, e.g. "daylight, smiling faces". Leave it empty if there is nothing in particular.
+   - "characters": the names of the recurring characters visible in the image.
+
+Reply with only a JSON object in this format:
+
+{"art_style": "1970s horror film still, grainy 35mm, saturated reds and deep shadows",
+ "characters": [{"name": "Sarah", "description": "a woman in her thirties with short dark hair, a yellow raincoat and wire-rimmed glasses"}],
+ "segments": [{"number": 1, "prompt": "A narrow attic staircase lit by a single flashlight beam, seen from below, dust hanging in the air", "negative_prompt": "daylight", "characters": ["Sarah"]}]}`,
+}
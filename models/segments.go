@@ -4,11 +4,33 @@ import "gorm.io/gorm"
 
 type Segment struct {
 	gorm.Model
-	ContentID int     `json:"content_id"`
-	StoryID   int     `json:"story_id"`
-	Segment   string  `json:"segment"`
-	Number    int     `json:"number"`    // If using integer for segment number
-	ImageURL  string  `json:"image_url"` // New field to store image URL
-	Duration  float64 `json:"duration"`  // New field to store duration
-	ImageData []byte  `json:"-"`         // exclude from gorm auto-migrate
+	ContentID       int               `json:"content_id"`
+	StoryID         int               `json:"story_id"`
+	Segment         string            `json:"segment"`
+	Number          int               `json:"number"`                              // If using integer for segment number
+	ImageKeys       map[string]string `json:"-" gorm:"type:jsonb;serializer:json"` // Stored images by aspect ratio, e.g. "16:9"
+	Duration        float64           `json:"duration"`                            // New field to store duration
+	ImageData       []byte            `json:"-"`                                   // exclude from gorm auto-migrate
+	AudioKey        string            `json:"-"`                                   // Stored narration, set once the segment's audio is stored
+	ClipKeys        map[string]string `json:"-" gorm:"type:jsonb;serializer:json"` // Stored clips by output profile
+	ReplacedKeys    []string          `json:"-" gorm:"type:jsonb;serializer:json"` // Objects a redo replaced, deleted once the replacements are stored
+	Words           []Word            `json:"words,omitempty" gorm:"type:jsonb;serializer:json"`
+	Motion          string            `json:"motion"`                                       // Camera motion preset, empty to follow the story's setting
+	SuggestedMotion string            `json:"suggested_motion"`                             // The segmenter's choice of motion, used when neither the segment nor story sets one
+	ImagePrompt     string            `json:"image_prompt"`                                 // What the segment's image should show, without the story's style
+	NegativePrompt  string            `json:"negative_prompt"`                              // What to keep out of the image
+	Seed            int64             `json:"seed"`                                         // Overrides the bible's seed, set when the image is regenerated
+	Mood            string            `json:"mood"`                                         // e.g. eerie or tense, from the segmenter
+	Characters      []string          `json:"characters" gorm:"type:jsonb;serializer:json"` // Characters present in the segment
+	Images          map[string][]byte `json:"-" gorm:"-"`                                   // Images by aspect ratio, only valid while rendering
+	AudioPath       string            `json:"-" gorm:"-"`                                   // Local TTS file, only valid while rendering
+	ClipPaths       map[string]string `json:"-" gorm:"-"`                                   // Local clip files by output profile, only valid while rendering
+}
+
+// Word is when one word of a segment is spoken, in seconds from the start of
+// the segment's narration
+type Word struct {
+	Text  string  `json:"text"`
+	Start float64 `json:"start"`
+	End   float64 `json:"end"`
 }
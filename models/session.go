@@ -0,0 +1,10 @@
+package models
+
+import "time"
+
+// Session is a login session's stored data, encoded by the session middleware
+type Session struct {
+	ID        string `gorm:"primaryKey"`
+	Data      []byte
+	ExpiresAt time.Time `gorm:"index"` // Zero for sessions that don't expire
+}
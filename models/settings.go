@@ -0,0 +1,36 @@
+package models
+
+// StorySettings are the per-story choices for how the video is made.
+// Empty values fall back to each backend's defaults.
+type StorySettings struct {
+	Draft bool `json:"draft"` // Stop after segmentation so the segments can be edited, until rendering is requested
+
+	Profiles  []string `json:"profiles" gorm:"type:jsonb;serializer:json"` // Output profiles, e.g. landscape or vertical-1080. The first is the main video
+	Motion    string   `json:"motion"`                                     // Camera motion for every segment, e.g. pan-left, or auto (default) to vary it
+	FrameRate int      `json:"frame_rate"`                                 // 6 (default), or 24 or 30 for smooth motion
+
+	ImageBackend string `json:"image_backend"` // replicate (default), http or placeholder
+	ImageModel   string `json:"image_model"`   // Backend specific, empty for the backend's default
+	ImageStyle   string `json:"image_style"`   // Art style, a preset such as woodcut, 70s-horror or watercolor, or a description. Empty to pick one for the story
+
+	Narrator   string  `json:"narrator"`    // openai (default), espeak, piper or silent
+	Voice      string  `json:"voice"`       // e.g. onyx for OpenAI, en-us for espeak
+	VoiceSpeed float64 `json:"voice_speed"` // 1 is normal speed, from 0.25 to 4. 0 for the default
+	VoiceModel string  `json:"voice_model"` // e.g. tts-1-hd
+
+	BurnCaptions    bool   `json:"burn_captions"`    // Draw the captions onto the video as well as the subtitle files
+	CaptionFont     string `json:"caption_font"`     // e.g. DejaVu Sans
+	CaptionSize     int    `json:"caption_size"`     // 0 for the default
+	CaptionPosition string `json:"caption_position"` // bottom (default), middle or top
+	KaraokeCaptions bool   `json:"karaoke_captions"` // Highlight each burned-in word as it is spoken
+
+	Transition        string  `json:"transition"`         // cut (default), crossfade, fadeblack, wipe or glitch
+	TransitionSeconds float64 `json:"transition_seconds"` // 0 for the default of half a second
+
+	Ambient        string  `json:"ambient"`          // A library track, e.g. storm, played under the narration
+	AmbientTrackID uint    `json:"ambient_track_id"` // Or one of the user's uploaded tracks
+	AmbientVolume  float64 `json:"ambient_volume"`   // 1 is the track's own level, 0 for the default of 0.3
+
+	PreviewFormat string `json:"preview_format"` // Animated preview as webp (default) or gif
+	HLS           bool   `json:"hls"`            // Also package the main video for adaptive streaming
+}
@@ -6,11 +6,42 @@ import (
 	"gorm.io/gorm"
 )
 
+// Story statuses, in the order the pipeline moves through them
+const (
+	StatusQueued     = "queued"
+	StatusSegmenting = "segmenting"
+	StatusDraft      = "draft" // Segmented, waiting for the user to edit the segments and start rendering
+	StatusImaging    = "imaging"
+	StatusNarrating  = "narrating"
+	StatusRendering  = "rendering"
+	StatusUploading  = "uploading"
+	StatusDone       = "done"
+	StatusFailed     = "failed"
+)
+
 type Story struct {
 	gorm.Model
-	Content   string    `json:"content" gorm:"text"`
-	CreatedBy int       `json:"created_by"`
-	CreatedAt time.Time `json:"created_at"`
-	Response  string    `json:"response" gorm:"text"` // New field to store API response
-	VideoURL  string    `json:"url"`
+	Title      string            `json:"title"`
+	Content    string            `json:"content" gorm:"text"`
+	CreatedBy  int               `json:"created_by"`
+	CreatedAt  time.Time         `json:"created_at"`
+	Response   string            `json:"response" gorm:"text"`                // New field to store API response
+	VideoKey   string            `json:"-"`                                   // The first profile's video
+	VideoKeys  map[string]string `json:"-" gorm:"type:jsonb;serializer:json"` // Every profile's video
+	SRTKey     string            `json:"-"`                                   // Subtitles stored next to the video
+	VTTKey     string            `json:"-"`
+	ASSKey     string            `json:"-"`
+	PosterKey  string            `json:"-"`
+	PreviewKey string            `json:"-"`
+	HLSKey     string            `json:"-"`                             // The HLS master playlist
+	VideoURL   string            `json:"url,omitempty" gorm:"-"`        // Signed link to the video, filled in per request
+	PosterURL  string            `json:"poster_url,omitempty" gorm:"-"` // Signed links to the poster and preview, filled in the same way
+	PreviewURL string            `json:"preview_url,omitempty" gorm:"-"`
+	HLSURL     string            `json:"hls_url,omitempty" gorm:"-"`                        // Signed link to the HLS master playlist
+	Bible      *StoryBible       `json:"bible,omitempty" gorm:"type:jsonb;serializer:json"` // Art style and characters, drawn up during segmentation unless given
+	Version    int               `json:"version" gorm:"default:1"`                          // Bumped each time segments are redone and the video rebuilt
+	Status     string            `json:"status" gorm:"index"`                               // Current pipeline stage
+	Error      string            `json:"error,omitempty" gorm:"text"`                       // Why the pipeline failed, if it did
+
+	StorySettings
 }
@@ -0,0 +1,165 @@
+package narrator
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"unicode"
+
+	"github.com/1rvyn/halloween-story-generator/models"
+)
+
+// Aligner finds when each word of a narration's text is spoken in its audio,
+// for narrators that don't report word timings themselves
+type Aligner interface {
+	Align(ctx context.Context, text string, audio []byte, format string) ([]models.Word, error)
+}
+
+// DefaultAligner is the aligner set up by InitializeAligner, or nil when word
+// timings are only estimated
+var DefaultAligner Aligner
+
+// InitializeAligner sets up DefaultAligner from WORD_ALIGNER
+//
+//	whisper (default) OpenAI's transcription API with word timestamps, or a
+//	        compatible server at WHISPER_URL. Needs OPENAI_API_KEY unless
+//	        WHISPER_URL is set, and is skipped by default without either.
+//	estimate no aligner, see EstimateWords
+func InitializeAligner() error {
+	switch backend := os.Getenv("WORD_ALIGNER"); backend {
+	case "", "whisper":
+		whisper := NewWhisper(os.Getenv("OPENAI_API_KEY"))
+		if url := os.Getenv("WHISPER_URL"); url != "" {
+			whisper.URL = url
+		}
+		if model := os.Getenv("WHISPER_MODEL"); model != "" {
+			whisper.Model = model
+		}
+		if whisper.APIKey == "" && whisper.URL == openAITranscriptionsURL {
+			if backend == "" {
+				return nil
+			}
+			return fmt.Errorf("OPENAI_API_KEY environment variable not set")
+		}
+		DefaultAligner = whisper
+	case "estimate":
+		DefaultAligner = nil
+	default:
+		return fmt.Errorf("unknown word aligner %q", backend)
+	}
+	return nil
+}
+
+// Span is a stretch of audio, in seconds
+type Span struct {
+	Start float64
+	End   float64
+}
+
+// EstimateWords guesses when each word of text is spoken, for backends that
+// don't report it. Words get time in proportion to their length and are laid
+// over the parts of the audio outside silences. Without any silences to go
+// on, punctuation gets some time of its own for the pauses it causes.
+func EstimateWords(text string, duration float64, silences []Span) []models.Word {
+	fields := strings.Fields(text)
+	if len(fields) == 0 || duration <= 0 {
+		return nil
+	}
+
+	speech := speechSpans(duration, silences)
+	speechLength := 0.0
+	for _, s := range speech {
+		speechLength += s.End - s.Start
+	}
+
+	weights := make([]float64, len(fields))
+	pauses := make([]float64, len(fields))
+	total := 0.0
+	for i, field := range fields {
+		for _, r := range field {
+			if unicode.IsLetter(r) || unicode.IsDigit(r) {
+				weights[i]++
+			}
+		}
+		if weights[i] == 0 {
+			weights[i] = 1
+		}
+		if len(silences) == 0 && i < len(fields)-1 {
+			pauses[i] = pauseWeight(field)
+		}
+		total += weights[i] + pauses[i]
+	}
+
+	words := make([]models.Word, len(fields))
+	unit := speechLength / total
+	at := 0.0
+	for i, field := range fields {
+		words[i] = models.Word{
+			Text:  field,
+			Start: speechTime(speech, at*unit, true),
+			End:   speechTime(speech, (at+weights[i])*unit, false),
+		}
+		at += weights[i] + pauses[i]
+	}
+	return words
+}
+
+// pauseWeight is how many letters' worth of pause follows a word
+func pauseWeight(word string) float64 {
+	switch word[len(word)-1] {
+	case '.', '!', '?':
+		return 4
+	case ',', ';', ':':
+		return 2
+	default:
+		return 0
+	}
+}
+
+// speechSpans returns the parts of [0, duration] not covered by silences
+func speechSpans(duration float64, silences []Span) []Span {
+	var spans []Span
+	at := 0.0
+	for _, silence := range silences {
+		if silence.Start > at {
+			spans = append(spans, Span{Start: at, End: minFloat(silence.Start, duration)})
+		}
+		if silence.End > at {
+			at = silence.End
+		}
+		if at >= duration {
+			break
+		}
+	}
+	if at < duration {
+		spans = append(spans, Span{Start: at, End: duration})
+	}
+	if len(spans) == 0 {
+		// The whole clip looked silent, so the detection can't be trusted
+		spans = []Span{{Start: 0, End: duration}}
+	}
+	return spans
+}
+
+// speechTime maps an offset into the speech, with the silences cut out, back
+// to a time in the audio. An offset that lands exactly between two spans
+// belongs to the next span when it starts a word, and the previous when it
+// ends one.
+func speechTime(spans []Span, offset float64, starting bool) float64 {
+	for i, s := range spans {
+		length := s.End - s.Start
+		if offset < length || (!starting && offset <= length) || i == len(spans)-1 {
+			return minFloat(s.Start+offset, s.End)
+		}
+		offset -= length
+	}
+	return 0
+}
+
+func minFloat(a, b float64) float64 {
+	if a < b {
+		return a
+	}
+	return b
+}
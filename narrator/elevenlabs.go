@@ -0,0 +1,144 @@
+package narrator
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/1rvyn/halloween-story-generator/models"
+)
+
+const elevenLabsURL = "https://api.elevenlabs.io"
+
+// elevenLabsVoicePattern matches voice IDs, which go in the request path
+var elevenLabsVoicePattern = regexp.MustCompile(`^[A-Za-z0-9]+$`)
+
+// ElevenLabs narrates with ElevenLabs' text-to-speech API, which reports when
+// each character is spoken, so captions can follow along word by word
+type ElevenLabs struct {
+	URL    string
+	APIKey string
+	Client *http.Client
+}
+
+// NewElevenLabs returns an ElevenLabs narrator
+func NewElevenLabs(apiKey string) *ElevenLabs {
+	return &ElevenLabs{
+		URL:    elevenLabsURL,
+		APIKey: apiKey,
+		Client: &http.Client{},
+	}
+}
+
+type elevenLabsResponse struct {
+	AudioBase64 string `json:"audio_base64"`
+	Alignment   struct {
+		Characters []string  `json:"characters"`
+		Starts     []float64 `json:"character_start_times_seconds"`
+		Ends       []float64 `json:"character_end_times_seconds"`
+	} `json:"alignment"`
+}
+
+func (e *ElevenLabs) CheckVoice(voice string) error {
+	if voice != "" && !elevenLabsVoicePattern.MatchString(voice) {
+		return fmt.Errorf("invalid ElevenLabs voice ID %q", voice)
+	}
+	return nil
+}
+
+func (e *ElevenLabs) Narrate(ctx context.Context, text string, opts Options) (*Audio, error) {
+	if text == "" {
+		return nil, errors.New("no text to narrate")
+	}
+
+	voice := opts.Voice
+	if voice == "" {
+		voice = "pNInz6obpgDQGcFmaJgB" // Adam
+	}
+	payload := map[string]interface{}{
+		"text":     text,
+		"model_id": "eleven_multilingual_v2",
+	}
+	if opts.Model != "" {
+		payload["model_id"] = opts.Model
+	}
+	if opts.Speed != 0 {
+		payload["voice_settings"] = map[string]interface{}{"speed": opts.Speed}
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	url := fmt.Sprintf("%s/v1/text-to-speech/%s/with-timestamps", e.URL, voice)
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("xi-api-key", e.APIKey)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := e.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("API request failed with status %d: %s", resp.StatusCode, string(bodyBytes))
+	}
+
+	var result elevenLabsResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("decoding speech response: %w", err)
+	}
+	data, err := base64.StdEncoding.DecodeString(result.AudioBase64)
+	if err != nil {
+		return nil, fmt.Errorf("decoding audio: %w", err)
+	}
+
+	a := result.Alignment
+	if len(a.Starts) != len(a.Characters) || len(a.Ends) != len(a.Characters) {
+		return nil, errors.New("speech response has mismatched alignment")
+	}
+	return &Audio{
+		Data:   data,
+		Format: "mp3",
+		Words:  wordsFromCharacters(a.Characters, a.Starts, a.Ends),
+	}, nil
+}
+
+// wordsFromCharacters groups per-character timings into words
+func wordsFromCharacters(chars []string, starts, ends []float64) []models.Word {
+	var words []models.Word
+	var word strings.Builder
+	var start, end float64
+	for i, c := range chars {
+		if strings.TrimFunc(c, unicode.IsSpace) == "" {
+			if word.Len() > 0 {
+				words = append(words, models.Word{Text: word.String(), Start: start, End: end})
+				word.Reset()
+			}
+			continue
+		}
+		if word.Len() == 0 {
+			start = starts[i]
+		}
+		word.WriteString(c)
+		end = ends[i]
+	}
+	if word.Len() > 0 {
+		words = append(words, models.Word{Text: word.String(), Start: start, End: end})
+	}
+	return words
+}
@@ -0,0 +1,132 @@
+package narrator
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Espeak narrates with the espeak-ng command-line synthesizer
+type Espeak struct {
+	Binary string
+}
+
+// NewEspeak returns an espeak-ng narrator
+func NewEspeak() *Espeak {
+	return &Espeak{Binary: "espeak-ng"}
+}
+
+// espeakVoicePattern matches espeak-ng voice names, e.g. en-us or mb-en1,
+// and keeps them from being read as flags
+var espeakVoicePattern = regexp.MustCompile(`^[a-z][a-zA-Z0-9_+-]*$`)
+
+func (e *Espeak) CheckVoice(voice string) error {
+	if voice != "" && !espeakVoicePattern.MatchString(voice) {
+		return fmt.Errorf("invalid espeak voice %q", voice)
+	}
+	return nil
+}
+
+func (e *Espeak) Narrate(ctx context.Context, text string, opts Options) (*Audio, error) {
+	voice := opts.Voice
+	if voice == "" {
+		voice = "en"
+	}
+	speed := opts.Speed
+	if speed == 0 {
+		speed = 1
+	}
+
+	return runToWAV(ctx, text, func(outputFile string) *exec.Cmd {
+		return exec.CommandContext(ctx, e.Binary,
+			"-v", voice,
+			"-s", fmt.Sprintf("%d", int(175*speed)), // words per minute, 175 is espeak's default
+			"-w", outputFile,
+			"--stdin",
+		)
+	})
+}
+
+// Piper narrates with the piper command-line synthesizer. Voices are the
+// names of .onnx models in VoicesDir.
+type Piper struct {
+	Binary    string
+	VoicesDir string
+}
+
+// NewPiper returns a piper narrator using the voice models in voicesDir
+func NewPiper(voicesDir string) *Piper {
+	return &Piper{Binary: "piper", VoicesDir: voicesDir}
+}
+
+// CheckVoice looks for the voice's model in VoicesDir
+func (p *Piper) CheckVoice(voice string) error {
+	if voice == "" {
+		return nil
+	}
+	if voice != filepath.Base(voice) {
+		return fmt.Errorf("invalid piper voice %q", voice)
+	}
+	if _, err := os.Stat(filepath.Join(p.VoicesDir, voice+".onnx")); err != nil {
+		return fmt.Errorf("unknown piper voice %q", voice)
+	}
+	return nil
+}
+
+func (p *Piper) Narrate(ctx context.Context, text string, opts Options) (*Audio, error) {
+	voice := opts.Voice
+	if voice == "" {
+		voice = "en_US-lessac-medium"
+	}
+	speed := opts.Speed
+	if speed == 0 {
+		speed = 1
+	}
+
+	return runToWAV(ctx, text, func(outputFile string) *exec.Cmd {
+		return exec.CommandContext(ctx, p.Binary,
+			"--model", filepath.Join(p.VoicesDir, filepath.Base(voice)+".onnx"),
+			"--length_scale", fmt.Sprintf("%.3f", 1/speed), // piper stretches time rather than speeding up
+			"--output_file", outputFile,
+		)
+	})
+}
+
+// runToWAV feeds text to a synthesizer on stdin and reads back the WAV file it writes
+func runToWAV(ctx context.Context, text string, command func(outputFile string) *exec.Cmd) (*Audio, error) {
+	if strings.TrimSpace(text) == "" {
+		return nil, errors.New("no text to narrate")
+	}
+
+	out, err := os.CreateTemp("", "narration_*.wav")
+	if err != nil {
+		return nil, err
+	}
+	out.Close()
+	defer os.Remove(out.Name())
+
+	cmd := command(out.Name())
+	cmd.Stdin = strings.NewReader(text)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("%s failed: %w: %s", filepath.Base(cmd.Path), err, stderr.String())
+	}
+
+	data, err := os.ReadFile(out.Name())
+	if err != nil {
+		return nil, err
+	}
+	duration, err := wavDuration(data)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Audio{Data: data, Format: "wav", Duration: duration}, nil
+}
@@ -0,0 +1,89 @@
+package narrator
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/1rvyn/halloween-story-generator/models"
+)
+
+// Options are the per-story voice settings. Zero values use the backend's defaults.
+type Options struct {
+	Voice string
+	Speed float64 // 1 is normal speed
+	Model string
+}
+
+// Audio is narration for one segment
+type Audio struct {
+	Data     []byte
+	Format   string        // File extension without the dot, e.g. "mp3" or "wav"
+	Duration float64       // Seconds, or 0 if the backend can't tell without probing the file
+	Words    []models.Word // When each word is spoken, if the backend reports it
+}
+
+// Speeds a story can ask for, the range OpenAI accepts. 0 uses the default.
+const (
+	MinSpeed = 0.25
+	MaxSpeed = 4.0
+)
+
+// Narrator turns segment text into speech
+type Narrator interface {
+	Narrate(ctx context.Context, text string, opts Options) (*Audio, error)
+	// CheckVoice returns an error if voice isn't one of the backend's voices.
+	// An empty voice is the backend's default.
+	CheckVoice(voice string) error
+}
+
+// CheckSpeed returns an error if speed is outside MinSpeed to MaxSpeed.
+// 0 is the backend's default.
+func CheckSpeed(speed float64) error {
+	if speed != 0 && (speed < MinSpeed || speed > MaxSpeed) {
+		return fmt.Errorf("voice speed %g is out of range, expected %g to %g", speed, MinSpeed, MaxSpeed)
+	}
+	return nil
+}
+
+// New returns the named backend, configured from the environment
+//
+//	openai (default) OpenAI's speech API, needs OPENAI_API_KEY
+//	elevenlabs ElevenLabs' speech API with word timings, needs ELEVENLABS_API_KEY
+//	espeak the espeak-ng command-line synthesizer
+//	piper  the piper command-line synthesizer, with voice models in PIPER_VOICES_DIR
+//	silent silence of a fixed length, for tests and offline runs
+func New(backend string) (Narrator, error) {
+	switch backend {
+	case "", "openai":
+		apiKey := os.Getenv("OPENAI_API_KEY")
+		if apiKey == "" {
+			return nil, fmt.Errorf("OPENAI_API_KEY environment variable not set")
+		}
+		return NewOpenAI(apiKey), nil
+	case "elevenlabs":
+		apiKey := os.Getenv("ELEVENLABS_API_KEY")
+		if apiKey == "" {
+			return nil, fmt.Errorf("ELEVENLABS_API_KEY environment variable not set")
+		}
+		return NewElevenLabs(apiKey), nil
+	case "espeak":
+		return NewEspeak(), nil
+	case "piper":
+		return NewPiper(os.Getenv("PIPER_VOICES_DIR")), nil
+	case "silent":
+		return NewSilent(3), nil
+	default:
+		return nil, fmt.Errorf("unknown narrator %q", backend)
+	}
+}
+
+// ContentType returns the MIME type for an audio format
+func ContentType(format string) string {
+	switch format {
+	case "wav":
+		return "audio/wav"
+	default:
+		return "audio/mpeg"
+	}
+}
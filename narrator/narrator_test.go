@@ -0,0 +1,226 @@
+package narrator
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/1rvyn/halloween-story-generator/models"
+)
+
+func TestSilentNarrate(t *testing.T) {
+	audio, err := NewSilent(2.5).Narrate(context.Background(), "Anything at all.", Options{})
+	if err != nil {
+		t.Fatalf("Expected success, got error: %v", err)
+	}
+	if audio.Format != "wav" || audio.Duration != 2.5 {
+		t.Errorf("Unexpected audio: format %s, duration %f", audio.Format, audio.Duration)
+	}
+
+	duration, err := wavDuration(audio.Data)
+	if err != nil {
+		t.Fatalf("Expected a valid WAV file, got error: %v", err)
+	}
+	if math.Abs(duration-2.5) > 0.001 {
+		t.Errorf("Expected WAV duration 2.5, got %f", duration)
+	}
+}
+
+func TestOpenAINarrate(t *testing.T) {
+	text := "She whispered, \"Who's there?\"\nNo one answered."
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			t.Errorf("Failed to decode request: %v", err)
+		}
+		if payload["input"] != text {
+			t.Errorf("Expected input %q, got %q", text, payload["input"])
+		}
+		if payload["voice"] != "alloy" || payload["speed"] != 1.25 || payload["model"] != "tts-1" {
+			t.Errorf("Unexpected payload: %v", payload)
+		}
+		w.Write([]byte("fake mp3"))
+	}))
+	defer server.Close()
+
+	n := NewOpenAI("test")
+	n.URL = server.URL
+	audio, err := n.Narrate(context.Background(), text, Options{Voice: "alloy", Speed: 1.25})
+	if err != nil {
+		t.Fatalf("Expected success, got error: %v", err)
+	}
+	if string(audio.Data) != "fake mp3" || audio.Format != "mp3" {
+		t.Errorf("Unexpected audio: %q (%s)", audio.Data, audio.Format)
+	}
+}
+
+func TestOpenAINarrateEmptyText(t *testing.T) {
+	if _, err := NewOpenAI("test").Narrate(context.Background(), "", Options{}); err == nil {
+		t.Error("Expected error for empty text, got nil")
+	}
+}
+
+func TestEstimateWords(t *testing.T) {
+	// One second of speech either side of a pause from 1s to 2s
+	words := EstimateWords("Hello there. Goodbye now", 3, []Span{{Start: 1, End: 2}})
+	if len(words) != 4 {
+		t.Fatalf("Expected 4 words, got %d", len(words))
+	}
+	if words[0].Start != 0 || words[3].End != 3 {
+		t.Errorf("Expected words to span the audio, got %+v", words)
+	}
+	for i, w := range words {
+		if w.End < w.Start || (i > 0 && w.Start < words[i-1].End) {
+			t.Errorf("Word %d is out of order: %+v", i, words)
+		}
+		if w.Start > 1 && w.Start < 2 {
+			t.Errorf("Word %q starts inside the pause at %f", w.Text, w.Start)
+		}
+	}
+	if words[2].Start != 2 {
+		t.Errorf("Expected the word after the pause to start at 2, got %f", words[2].Start)
+	}
+}
+
+func TestElevenLabsWordTimings(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("xi-api-key") != "test" || r.URL.Path != "/v1/text-to-speech/voice-id/with-timestamps" {
+			t.Errorf("Unexpected request %s with key %q", r.URL.Path, r.Header.Get("xi-api-key"))
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"audio_base64": "ZmFrZSBtcDM=",
+			"alignment": map[string]interface{}{
+				"characters":                    []string{"B", "o", "o", "!", " ", "H", "i"},
+				"character_start_times_seconds": []float64{0, 0.1, 0.2, 0.3, 0.4, 0.5, 0.6},
+				"character_end_times_seconds":   []float64{0.1, 0.2, 0.3, 0.4, 0.5, 0.6, 0.7},
+			},
+		})
+	}))
+	defer server.Close()
+
+	n := NewElevenLabs("test")
+	n.URL = server.URL
+	audio, err := n.Narrate(context.Background(), "Boo! Hi", Options{Voice: "voice-id"})
+	if err != nil {
+		t.Fatalf("Expected success, got error: %v", err)
+	}
+	if string(audio.Data) != "fake mp3" {
+		t.Errorf("Unexpected audio %q", audio.Data)
+	}
+	if len(audio.Words) != 2 || audio.Words[0].Text != "Boo!" || audio.Words[0].End != 0.4 ||
+		audio.Words[1].Text != "Hi" || audio.Words[1].Start != 0.5 {
+		t.Errorf("Unexpected words %+v", audio.Words)
+	}
+}
+
+func TestCheckSpeed(t *testing.T) {
+	for _, speed := range []float64{0, 0.25, 1, 4} {
+		if err := CheckSpeed(speed); err != nil {
+			t.Errorf("Expected speed %g to be accepted, got error: %v", speed, err)
+		}
+	}
+	for _, speed := range []float64{-1, 0.1, 4.5, 100} {
+		if err := CheckSpeed(speed); err == nil {
+			t.Errorf("Expected speed %g to be rejected", speed)
+		}
+	}
+}
+
+func TestCheckVoice(t *testing.T) {
+	voicesDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(voicesDir, "en_GB-alan-low.onnx"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		narrator Narrator
+		voice    string
+		valid    bool
+	}{
+		{NewOpenAI("key"), "", true},
+		{NewOpenAI("key"), "onyx", true},
+		{NewOpenAI("key"), "gravelly", false},
+		{NewElevenLabs("key"), "pNInz6obpgDQGcFmaJgB", true},
+		{NewElevenLabs("key"), "../v1/user", false},
+		{NewEspeak(), "en-us", true},
+		{NewEspeak(), "--help", false},
+		{NewPiper(voicesDir), "en_GB-alan-low", true},
+		{NewPiper(voicesDir), "en_US-missing-medium", false},
+		{NewPiper(voicesDir), "../en_GB-alan-low", false},
+		{NewSilent(1), "anything", true},
+	}
+	for _, test := range tests {
+		err := test.narrator.CheckVoice(test.voice)
+		if test.valid && err != nil {
+			t.Errorf("Expected %T to accept voice %q, got error: %v", test.narrator, test.voice, err)
+		}
+		if !test.valid && err == nil {
+			t.Errorf("Expected %T to reject voice %q", test.narrator, test.voice)
+		}
+	}
+}
+
+func TestWhisperAlign(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseMultipartForm(1 << 20); err != nil {
+			t.Errorf("Failed to parse form: %v", err)
+			return
+		}
+		if got := r.FormValue("timestamp_granularities[]"); got != "word" {
+			t.Errorf("Expected word timestamps, got %q", got)
+		}
+		if _, header, err := r.FormFile("file"); err != nil || header.Filename != "narration.mp3" {
+			t.Errorf("Expected the audio as narration.mp3, got %v", err)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		// "Who's" is misheard and "answered" is dropped
+		w.Write([]byte(`{"text": "She whispered, who is there? No one.", "words": [
+			{"word": "She", "start": 0.1, "end": 0.3},
+			{"word": "whispered", "start": 0.3, "end": 0.9},
+			{"word": "who", "start": 1.0, "end": 1.1},
+			{"word": "is", "start": 1.1, "end": 1.2},
+			{"word": "there", "start": 1.2, "end": 1.5},
+			{"word": "No", "start": 2.0, "end": 2.2},
+			{"word": "one", "start": 2.2, "end": 2.4}
+		]}`))
+	}))
+	defer server.Close()
+
+	whisper := NewWhisper("key")
+	whisper.URL = server.URL
+	words, err := whisper.Align(context.Background(), "She whispered, \"Who's there?\"\nNo one answered.", []byte("audio"), "mp3")
+	if err != nil {
+		t.Fatalf("Expected success, got error: %v", err)
+	}
+
+	want := []models.Word{
+		{Text: "She", Start: 0.1, End: 0.3},
+		{Text: "whispered,", Start: 0.3, End: 0.9},
+		{Text: "\"Who's", Start: 0.9, End: 1.2},
+		{Text: "there?\"", Start: 1.2, End: 1.5},
+		{Text: "No", Start: 2.0, End: 2.2},
+		{Text: "one", Start: 2.2, End: 2.4},
+		{Text: "answered.", Start: 2.4, End: 2.4},
+	}
+	if len(words) != len(want) {
+		t.Fatalf("Expected %d words, got %+v", len(want), words)
+	}
+	for i := range want {
+		if words[i].Text != want[i].Text || math.Abs(words[i].Start-want[i].Start) > 1e-9 || math.Abs(words[i].End-want[i].End) > 1e-9 {
+			t.Errorf("Word %d = %+v, expected %+v", i, words[i], want[i])
+		}
+	}
+}
+
+func TestMatchWordsRejectsAnotherText(t *testing.T) {
+	heard := []models.Word{{Text: "Something", Start: 0, End: 1}, {Text: "else", Start: 1, End: 2}}
+	if _, err := matchWords([]string{"The", "door", "creaked", "open."}, heard); err == nil {
+		t.Error("Expected a transcript of other words to be rejected")
+	}
+}
@@ -0,0 +1,98 @@
+package narrator
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+const openAISpeechURL = "https://api.openai.com/v1/audio/speech"
+
+// openAIVoices are the voices the speech API offers
+var openAIVoices = []string{"alloy", "ash", "ballad", "coral", "echo", "fable", "nova", "onyx", "sage", "shimmer", "verse"}
+
+// OpenAI narrates with OpenAI's text-to-speech API
+type OpenAI struct {
+	URL    string
+	APIKey string
+	Client *http.Client
+}
+
+// NewOpenAI returns an OpenAI narrator
+func NewOpenAI(apiKey string) *OpenAI {
+	return &OpenAI{
+		URL:    openAISpeechURL,
+		APIKey: apiKey,
+		Client: &http.Client{},
+	}
+}
+
+func (o *OpenAI) CheckVoice(voice string) error {
+	if voice == "" {
+		return nil
+	}
+	for _, v := range openAIVoices {
+		if voice == v {
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown OpenAI voice %q, expected one of %s", voice, strings.Join(openAIVoices, ", "))
+}
+
+func (o *OpenAI) Narrate(ctx context.Context, text string, opts Options) (*Audio, error) {
+	if text == "" {
+		return nil, errors.New("no text to narrate")
+	}
+
+	payload := map[string]interface{}{
+		"model":           "tts-1",
+		"input":           text,
+		"voice":           "onyx",
+		"response_format": "mp3",
+	}
+	if opts.Model != "" {
+		payload["model"] = opts.Model
+	}
+	if opts.Voice != "" {
+		payload["voice"] = opts.Voice
+	}
+	if opts.Speed != 0 {
+		payload["speed"] = opts.Speed
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", o.URL, bytes.NewBuffer(body))
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Authorization", "Bearer "+o.APIKey)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := o.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("API request failed with status %d: %s", resp.StatusCode, string(bodyBytes))
+	}
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Audio{Data: data, Format: "mp3"}, nil
+}
@@ -0,0 +1,28 @@
+package narrator
+
+import "context"
+
+// Silent returns the same length of silence for every segment, so the
+// pipeline can run without a speech backend
+type Silent struct {
+	Seconds float64
+}
+
+// NewSilent returns a narrator that produces seconds of silence
+func NewSilent(seconds float64) *Silent {
+	return &Silent{Seconds: seconds}
+}
+
+// CheckVoice accepts any voice, there's nothing to say
+func (s *Silent) CheckVoice(voice string) error {
+	return nil
+}
+
+func (s *Silent) Narrate(ctx context.Context, text string, opts Options) (*Audio, error) {
+	return &Audio{
+		Data:     silentWAV(s.Seconds, 22050),
+		Format:   "wav",
+		Duration: s.Seconds,
+		Words:    EstimateWords(text, s.Seconds, nil),
+	}, nil
+}
@@ -0,0 +1,67 @@
+package narrator
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+)
+
+// silentWAV returns a mono 16-bit PCM WAV file of silence
+func silentWAV(seconds float64, sampleRate int) []byte {
+	dataSize := int(seconds*float64(sampleRate)) * 2
+
+	var buf bytes.Buffer
+	buf.WriteString("RIFF")
+	binary.Write(&buf, binary.LittleEndian, uint32(36+dataSize))
+	buf.WriteString("WAVE")
+
+	buf.WriteString("fmt ")
+	binary.Write(&buf, binary.LittleEndian, uint32(16))           // chunk size
+	binary.Write(&buf, binary.LittleEndian, uint16(1))            // PCM
+	binary.Write(&buf, binary.LittleEndian, uint16(1))            // mono
+	binary.Write(&buf, binary.LittleEndian, uint32(sampleRate))   // sample rate
+	binary.Write(&buf, binary.LittleEndian, uint32(sampleRate*2)) // byte rate
+	binary.Write(&buf, binary.LittleEndian, uint16(2))            // block align
+	binary.Write(&buf, binary.LittleEndian, uint16(16))           // bits per sample
+
+	buf.WriteString("data")
+	binary.Write(&buf, binary.LittleEndian, uint32(dataSize))
+	buf.Write(make([]byte, dataSize))
+
+	return buf.Bytes()
+}
+
+// wavDuration reads the length of a PCM WAV file from its headers
+func wavDuration(data []byte) (float64, error) {
+	if len(data) < 12 || string(data[0:4]) != "RIFF" || string(data[8:12]) != "WAVE" {
+		return 0, errors.New("not a WAV file")
+	}
+
+	var byteRate uint32
+	for pos := 12; pos+8 <= len(data); {
+		id := string(data[pos : pos+4])
+		size := binary.LittleEndian.Uint32(data[pos+4 : pos+8])
+		body := pos + 8
+
+		switch id {
+		case "fmt ":
+			if body+12 > len(data) {
+				return 0, errors.New("truncated WAV format chunk")
+			}
+			byteRate = binary.LittleEndian.Uint32(data[body+8 : body+12])
+		case "data":
+			if byteRate == 0 {
+				return 0, errors.New("WAV data chunk before format chunk")
+			}
+			// Streaming writers sometimes leave the size unset, so trust the file length over it
+			if size == 0 || size == 0xffffffff || body+int(size) > len(data) {
+				size = uint32(len(data) - body)
+			}
+			return float64(size) / float64(byteRate), nil
+		}
+
+		pos = body + int(size) + int(size%2)
+	}
+
+	return 0, errors.New("WAV file has no data chunk")
+}
@@ -0,0 +1,196 @@
+package narrator
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"strings"
+	"unicode"
+
+	"github.com/1rvyn/halloween-story-generator/models"
+)
+
+const openAITranscriptionsURL = "https://api.openai.com/v1/audio/transcriptions"
+
+// Whisper aligns narration by transcribing it with word timestamps, using
+// OpenAI's transcription API or a self-hosted server that speaks it
+type Whisper struct {
+	URL    string
+	APIKey string
+	Model  string
+	Client *http.Client
+}
+
+// NewWhisper returns an aligner using OpenAI's whisper-1 model
+func NewWhisper(apiKey string) *Whisper {
+	return &Whisper{
+		URL:    openAITranscriptionsURL,
+		APIKey: apiKey,
+		Model:  "whisper-1",
+		Client: &http.Client{},
+	}
+}
+
+type whisperResponse struct {
+	Words []struct {
+		Word  string  `json:"word"`
+		Start float64 `json:"start"`
+		End   float64 `json:"end"`
+	} `json:"words"`
+}
+
+func (w *Whisper) Align(ctx context.Context, text string, audio []byte, format string) ([]models.Word, error) {
+	fields := strings.Fields(text)
+	if len(fields) == 0 {
+		return nil, errors.New("no text to align")
+	}
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	file, err := form.CreateFormFile("file", "narration."+format)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := file.Write(audio); err != nil {
+		return nil, err
+	}
+	form.WriteField("model", w.Model)
+	form.WriteField("response_format", "verbose_json")
+	form.WriteField("timestamp_granularities[]", "word")
+	form.WriteField("prompt", text) // Helps with names and spelling the story uses
+	if err := form.Close(); err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", w.URL, &body)
+	if err != nil {
+		return nil, err
+	}
+	if w.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+w.APIKey)
+	}
+	req.Header.Set("Content-Type", form.FormDataContentType())
+
+	resp, err := w.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("API request failed with status %d: %s", resp.StatusCode, string(bodyBytes))
+	}
+
+	var result whisperResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("decoding transcription: %w", err)
+	}
+	heard := make([]models.Word, len(result.Words))
+	for i, word := range result.Words {
+		heard[i] = models.Word{Text: word.Word, Start: word.Start, End: word.End}
+	}
+	return matchWords(fields, heard)
+}
+
+// matchWords puts the timings of the words heard in the audio on the words
+// of the script. The two are matched up by their longest common subsequence,
+// ignoring case and punctuation, so a misheard or dropped word doesn't throw
+// off the rest. Script words with no match share the time between their
+// matched neighbours.
+func matchWords(fields []string, heard []models.Word) ([]models.Word, error) {
+	n, m := len(fields), len(heard)
+	script := make([]string, n)
+	for i, field := range fields {
+		script[i] = normalizeWord(field)
+	}
+	transcript := make([]string, m)
+	for j, word := range heard {
+		transcript[j] = normalizeWord(word.Text)
+	}
+
+	// lengths[i][j] is the longest common subsequence of script[i:] and transcript[j:]
+	lengths := make([][]int, n+1)
+	for i := range lengths {
+		lengths[i] = make([]int, m+1)
+	}
+	for i := n - 1; i >= 0; i-- {
+		for j := m - 1; j >= 0; j-- {
+			switch {
+			case script[i] != "" && script[i] == transcript[j]:
+				lengths[i][j] = lengths[i+1][j+1] + 1
+			case lengths[i+1][j] >= lengths[i][j+1]:
+				lengths[i][j] = lengths[i+1][j]
+			default:
+				lengths[i][j] = lengths[i][j+1]
+			}
+		}
+	}
+	if matched := lengths[0][0]; matched*2 < n {
+		return nil, fmt.Errorf("transcription matches only %d of %d words", matched, n)
+	}
+
+	words := make([]models.Word, n)
+	matched := make([]bool, n)
+	for i, j := 0, 0; i < n && j < m; {
+		switch {
+		case script[i] != "" && script[i] == transcript[j]:
+			words[i] = models.Word{Text: fields[i], Start: heard[j].Start, End: heard[j].End}
+			matched[i] = true
+			i++
+			j++
+		case lengths[i+1][j] >= lengths[i][j+1]:
+			i++
+		default:
+			j++
+		}
+	}
+
+	end := 0.0
+	if m > 0 {
+		end = heard[m-1].End
+	}
+	for i := 0; i < n; {
+		if matched[i] {
+			i++
+			continue
+		}
+		// Spread the run of unmatched words [i, k) over the gap around it
+		k := i
+		for k < n && !matched[k] {
+			k++
+		}
+		from, to := 0.0, end
+		if i > 0 {
+			from = words[i-1].End
+		}
+		if k < n {
+			to = words[k].Start
+		}
+		step := (to - from) / float64(k-i)
+		for x := i; x < k; x++ {
+			words[x] = models.Word{
+				Text:  fields[x],
+				Start: from + step*float64(x-i),
+				End:   from + step*float64(x-i+1),
+			}
+		}
+		i = k
+	}
+	return words, nil
+}
+
+// normalizeWord keeps only a word's letters and digits, in lower case
+func normalizeWord(word string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return unicode.ToLower(r)
+		}
+		return -1
+	}, word)
+}
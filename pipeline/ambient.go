@@ -0,0 +1,155 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/1rvyn/halloween-story-generator/database"
+	"github.com/1rvyn/halloween-story-generator/misc"
+	"github.com/1rvyn/halloween-story-generator/models"
+	"github.com/1rvyn/halloween-story-generator/storage"
+	"gorm.io/gorm"
+)
+
+// ambientLibraryPrefix is where the shared ambient tracks are stored, one
+// object per track named after it, as ambient/library/<name>.<ext>, e.g.
+// ambient/library/storm.mp3. SeedAmbientLibrary stores the built-in ones;
+// more can be added by uploading audio under the same scheme.
+const ambientLibraryPrefix = "ambient/library/"
+
+// maxAmbientVolume keeps a typo from blowing out the narration
+const maxAmbientVolume = 2
+
+// ErrUnknownAmbient is returned for a story asking for a track that doesn't exist
+var ErrUnknownAmbient = errors.New("unknown ambient track")
+
+// AmbientLibrary returns the names of the shared ambient tracks
+func AmbientLibrary(ctx context.Context) ([]string, error) {
+	keys, err := storage.Default.List(ctx, ambientLibraryPrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(keys))
+	for _, key := range keys {
+		name := path.Base(key)
+		names = append(names, strings.TrimSuffix(name, path.Ext(name)))
+	}
+	return names, nil
+}
+
+// SeedAmbientLibrary renders the built-in ambient beds missing from the
+// library and stores them. A track already stored under a bed's name, such
+// as a recording uploaded to replace it, is left alone.
+func SeedAmbientLibrary(ctx context.Context) error {
+	library, err := AmbientLibrary(ctx)
+	if err != nil {
+		return fmt.Errorf("listing ambient library: %w", err)
+	}
+	stored := make(map[string]bool, len(library))
+	for _, name := range library {
+		stored[name] = true
+	}
+
+	for _, name := range misc.AmbientBedNames() {
+		if stored[name] {
+			continue
+		}
+		bedPath, err := misc.RenderAmbientBed(name)
+		if err != nil {
+			return fmt.Errorf("rendering ambient bed %s: %w", name, err)
+		}
+		err = putFile(ambientLibraryPrefix+name+misc.AmbientBedExt, bedPath, "audio/mpeg")
+		os.Remove(bedPath)
+		if err != nil {
+			return err
+		}
+		log.Printf("Added %s to the ambient library", name)
+	}
+	return nil
+}
+
+// AmbientKey returns the stored ambient track a story asked for, or an empty
+// key if it didn't ask for one. Uploaded tracks must belong to the story's author.
+func AmbientKey(story *models.Story) (string, error) {
+	if story.AmbientVolume < 0 || story.AmbientVolume > maxAmbientVolume {
+		return "", fmt.Errorf("ambient volume must be between 0 and %d", maxAmbientVolume)
+	}
+
+	switch {
+	case story.Ambient != "" && story.AmbientTrackID != 0:
+		return "", errors.New("choose either a library ambient track or an uploaded one, not both")
+
+	case story.AmbientTrackID != 0:
+		var track models.AmbientTrack
+		err := database.DB.Where("id = ? AND created_by = ?", story.AmbientTrackID, story.CreatedBy).First(&track).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return "", fmt.Errorf("%w %d", ErrUnknownAmbient, story.AmbientTrackID)
+		}
+		if err != nil {
+			return "", fmt.Errorf("loading ambient track %d: %w", story.AmbientTrackID, err)
+		}
+		return track.Key, nil
+
+	case story.Ambient != "":
+		if strings.Contains(story.Ambient, "/") {
+			return "", fmt.Errorf("%w %q", ErrUnknownAmbient, story.Ambient)
+		}
+		keys, err := storage.Default.List(context.TODO(), ambientLibraryPrefix+story.Ambient+".")
+		if err != nil {
+			return "", fmt.Errorf("listing ambient tracks: %w", err)
+		}
+		if len(keys) == 0 {
+			return "", fmt.Errorf("%w %q", ErrUnknownAmbient, story.Ambient)
+		}
+		return keys[0], nil
+	}
+
+	return "", nil
+}
+
+// StoreAmbientTrack saves a user's uploaded ambient track
+func StoreAmbientTrack(userID uint, name, ext string, body io.Reader, contentType string) (*models.AmbientTrack, error) {
+	track := &models.AmbientTrack{Name: name, CreatedBy: int(userID)}
+	if err := database.DB.Create(track).Error; err != nil {
+		return nil, err
+	}
+
+	key := ambientUploadKey(userID, track.ID, ext)
+	if err := putObject(key, body, contentType); err != nil {
+		database.DB.Unscoped().Delete(track)
+		return nil, err
+	}
+
+	track.Key = key
+	if err := database.DB.Model(track).Update("key", key).Error; err != nil {
+		return nil, err
+	}
+	return track, nil
+}
+
+// fetchAmbient downloads the story's ambient track, if it has one, and
+// returns its local path
+func fetchAmbient(story *models.Story) (string, error) {
+	key, err := AmbientKey(story)
+	if err != nil || key == "" {
+		return "", err
+	}
+
+	tempDir, err := misc.TempDirectory()
+	if err != nil {
+		return "", err
+	}
+	ambientPath := filepath.Join(tempDir, fmt.Sprintf("story_%d_ambient%s", story.ID, path.Ext(key)))
+	if err := getFile(key, ambientPath); err != nil {
+		return "", err
+	}
+	return ambientPath, nil
+}
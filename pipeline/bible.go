@@ -0,0 +1,184 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math/rand"
+	"strings"
+
+	"github.com/1rvyn/halloween-story-generator/database"
+	"github.com/1rvyn/halloween-story-generator/imagegen"
+	"github.com/1rvyn/halloween-story-generator/models"
+	"github.com/1rvyn/halloween-story-generator/segmenter"
+)
+
+// Image prompt defaults, for stories whose bible doesn't settle them
+const (
+	defaultImageStyle     = "Dark, atmospheric horror illustration, cinematic lighting, muted colours, film grain, highly detailed"
+	defaultNegativePrompt = "text, captions, watermark, logo, signature, blurry, low quality, deformed hands, extra limbs, cartoon"
+)
+
+// artStyles are the presets a story's image_style can name
+var artStyles = map[string]string{
+	"woodcut":    "Woodcut print, bold black carved lines, heavy contrast, rough paper texture, limited palette",
+	"70s-horror": "1970s horror film still, grainy 35mm film, saturated reds, deep shadows, soft focus",
+	"watercolor": "Watercolor painting, loose washes bleeding into each other, muted greys and blues, paper texture",
+	"noir":       "Black and white film noir still, hard light, long shadows, high contrast",
+	"gothic":     "Gothic oil painting, candlelit chiaroscuro, rich dark colours, visible brush strokes",
+}
+
+const maxBibleCharacters = 20
+
+// ArtStyle expands an art style preset, leaving descriptions as they are
+func ArtStyle(style string) string {
+	if preset, ok := artStyles[strings.ToLower(strings.TrimSpace(style))]; ok {
+		return preset
+	}
+	return strings.TrimSpace(style)
+}
+
+// ValidateBible checks a story bible given by the user
+func ValidateBible(bible *models.StoryBible) error {
+	if len(bible.ArtStyle) > 500 {
+		return fmt.Errorf("art style is too long, the limit is 500 characters")
+	}
+	if bible.Seed < 0 {
+		return fmt.Errorf("seed must not be negative")
+	}
+	if len(bible.Characters) > maxBibleCharacters {
+		return fmt.Errorf("too many characters, the limit is %d", maxBibleCharacters)
+	}
+	seen := make(map[string]bool, len(bible.Characters))
+	for _, character := range bible.Characters {
+		name := strings.ToLower(strings.TrimSpace(character.Name))
+		if name == "" || strings.TrimSpace(character.Description) == "" {
+			return fmt.Errorf("every character needs a name and a description")
+		}
+		if seen[name] {
+			return fmt.Errorf("character %q is listed more than once", character.Name)
+		}
+		seen[name] = true
+		if character.Seed < 0 {
+			return fmt.Errorf("seed for %q must not be negative", character.Name)
+		}
+	}
+	return nil
+}
+
+// AssignSeeds gives the bible, and every character in it, a seed if it
+// doesn't have one, so their images come out alike
+func AssignSeeds(bible *models.StoryBible) {
+	if bible.Seed == 0 {
+		bible.Seed = newSeed()
+	}
+	for i := range bible.Characters {
+		if bible.Characters[i].Seed == 0 {
+			bible.Characters[i].Seed = newSeed()
+		}
+	}
+}
+
+// newSeed returns a positive seed small enough for any backend
+func newSeed() int64 {
+	return rand.Int63n(1<<31-1) + 1
+}
+
+// draftBible fills in the story's bible from its segments and stores it, and
+// writes each segment's image prompt. Whatever the user gave in the bible is
+// kept. The segmenter's model, when there is one, picks the art style and
+// describes the characters; otherwise, or if it fails, the images use the
+// default style and are drawn from each segment's scene or narration.
+func draftBible(story *models.Story, parts []segmenter.Segment, segments []models.Segment) error {
+	bible := story.Bible
+	if bible == nil {
+		bible = &models.StoryBible{}
+	}
+	if bible.ArtStyle == "" && story.ImageStyle != "" {
+		bible.ArtStyle = ArtStyle(story.ImageStyle)
+	}
+
+	if prompter, ok := segmenter.Default.(segmenter.Prompter); ok {
+		visuals, err := prompter.Visuals(context.TODO(), story.Content, parts, bible)
+		if err != nil {
+			log.Printf("Warning: Failed to write image prompts for story %d: %v", story.ID, err)
+		} else {
+			if bible.ArtStyle == "" {
+				bible.ArtStyle = visuals.ArtStyle
+			}
+			for _, character := range visuals.Characters {
+				if bible.Character(character.Name) == nil && len(bible.Characters) < maxBibleCharacters {
+					bible.Characters = append(bible.Characters, character)
+				}
+			}
+			for i, prompt := range visuals.Prompts {
+				segments[i].ImagePrompt = prompt.Prompt
+				segments[i].NegativePrompt = prompt.NegativePrompt
+				segments[i].Characters = prompt.Characters
+			}
+		}
+	}
+
+	if bible.ArtStyle == "" {
+		bible.ArtStyle = defaultImageStyle
+	}
+	AssignSeeds(bible)
+
+	story.Bible = bible
+	if err := database.DB.Model(story).Select("bible").Updates(story).Error; err != nil {
+		return fmt.Errorf("storing story bible: %w", err)
+	}
+	return nil
+}
+
+// ImageRequest returns the request for a segment's image: the bible's art
+// style, the segment's prompt, falling back to its narration, and the
+// descriptions of the characters in it. The seed is the segment's own if it
+// was regenerated, else the first character's, or the story's when there are none.
+func ImageRequest(story *models.Story, seg *models.Segment, aspect string) imagegen.Request {
+	bible := story.Bible
+	if bible == nil {
+		bible = &models.StoryBible{ArtStyle: ArtStyle(story.ImageStyle)}
+	}
+	style := bible.ArtStyle
+	if style == "" {
+		style = defaultImageStyle
+	}
+
+	prompt := seg.ImagePrompt
+	if prompt == "" {
+		prompt = seg.Segment
+	}
+	parts := []string{strings.TrimSuffix(strings.TrimSpace(style), "."), strings.TrimSuffix(strings.TrimSpace(prompt), ".")}
+
+	seed := bible.Seed
+	var characters []string
+	for _, name := range seg.Characters {
+		character := bible.Character(name)
+		if character == nil {
+			continue
+		}
+		if len(characters) == 0 && character.Seed != 0 {
+			seed = character.Seed
+		}
+		characters = append(characters, character.Name+", "+character.Description)
+	}
+	if len(characters) > 0 {
+		parts = append(parts, strings.Join(characters, "; "))
+	}
+	if seg.Seed != 0 {
+		seed = seg.Seed
+	}
+
+	negative := defaultNegativePrompt
+	if seg.NegativePrompt != "" {
+		negative += ", " + seg.NegativePrompt
+	}
+
+	return imagegen.Request{
+		Prompt:         strings.Join(parts, ". ") + ".",
+		NegativePrompt: negative,
+		AspectRatio:    aspect,
+		Seed:           seed,
+	}
+}
@@ -0,0 +1,258 @@
+package pipeline
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/1rvyn/halloween-story-generator/database"
+	"github.com/1rvyn/halloween-story-generator/misc"
+	"github.com/1rvyn/halloween-story-generator/models"
+	"github.com/1rvyn/halloween-story-generator/segmenter"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrNotDraft is returned when editing the segments of a story that isn't a draft
+var ErrNotDraft = errors.New("story is not a draft")
+
+// EditError is a segment edit that doesn't make sense, such as splitting a
+// segment past its end. Its message is meant for the user.
+type EditError struct {
+	msg string
+}
+
+func (e *EditError) Error() string { return e.msg }
+
+func editErrorf(format string, args ...interface{}) error {
+	return &EditError{msg: fmt.Sprintf(format, args...)}
+}
+
+// EditDraft applies edit to a draft story's segments, in order, and stores
+// the result numbered 1, 2, 3... Segments edit drops are deleted, and new
+// ones, with no ID, are created. The story is locked meanwhile, so edits
+// can't race each other or a render starting.
+func EditDraft(story *models.Story, edit func([]models.Segment) ([]models.Segment, error)) ([]models.Segment, error) {
+	var result []models.Segment
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		var locked models.Story
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&locked, story.ID).Error; err != nil {
+			return err
+		}
+		if locked.Status != models.StatusDraft {
+			return ErrNotDraft
+		}
+
+		var segments []models.Segment
+		if err := tx.Where("story_id = ?", story.ID).Order("number").Find(&segments).Error; err != nil {
+			return err
+		}
+		edited, err := edit(segments)
+		if err != nil {
+			return err
+		}
+		if err := validateDraft(edited); err != nil {
+			return err
+		}
+
+		kept := make(map[uint]bool, len(edited))
+		for i := range edited {
+			seg := &edited[i]
+			seg.Number = i + 1
+			seg.StoryID = int(story.ID)
+			if seg.ID == 0 {
+				if err := tx.Create(seg).Error; err != nil {
+					return err
+				}
+			} else if err := tx.Model(seg).
+				Select("number", "segment", "image_prompt", "negative_prompt", "mood", "characters", "motion", "suggested_motion").
+				Updates(seg).Error; err != nil {
+				return err
+			}
+			kept[seg.ID] = true
+		}
+		for _, seg := range segments {
+			if !kept[seg.ID] {
+				if err := tx.Delete(&seg).Error; err != nil {
+					return err
+				}
+			}
+		}
+
+		result = edited
+		return nil
+	})
+	return result, err
+}
+
+func validateDraft(segments []models.Segment) error {
+	if len(segments) == 0 {
+		return editErrorf("a story needs at least one segment")
+	}
+	for _, seg := range segments {
+		if strings.TrimSpace(seg.Segment) == "" {
+			return editErrorf("segments can't be empty")
+		}
+		if len(seg.Segment) > segmenter.MaxSegmentChars {
+			return editErrorf("segments can be at most %d characters long", segmenter.MaxSegmentChars)
+		}
+	}
+	return nil
+}
+
+// segmentIndex finds a segment by number
+func segmentIndex(segments []models.Segment, number int) (int, error) {
+	for i, seg := range segments {
+		if seg.Number == number {
+			return i, nil
+		}
+	}
+	return 0, editErrorf("segment %d not found", number)
+}
+
+// SegmentChanges are the fields of a segment a user can edit, nil for
+// those to leave alone
+type SegmentChanges struct {
+	Text           *string `json:"text"`
+	ImagePrompt    *string `json:"image_prompt"`
+	NegativePrompt *string `json:"negative_prompt"`
+	Motion         *string `json:"motion"`
+}
+
+// ChangeSegment edits a segment's text, image prompts or camera motion
+func ChangeSegment(segments []models.Segment, number int, changes SegmentChanges) ([]models.Segment, error) {
+	i, err := segmentIndex(segments, number)
+	if err != nil {
+		return nil, err
+	}
+	out := append([]models.Segment{}, segments...)
+	seg := &out[i]
+	if changes.Text != nil {
+		seg.Segment = strings.TrimSpace(*changes.Text)
+	}
+	if changes.ImagePrompt != nil {
+		seg.ImagePrompt = strings.TrimSpace(*changes.ImagePrompt)
+	}
+	if changes.NegativePrompt != nil {
+		seg.NegativePrompt = strings.TrimSpace(*changes.NegativePrompt)
+	}
+	if changes.Motion != nil {
+		if err := misc.ValidateMotion(*changes.Motion); err != nil {
+			return nil, editErrorf("%v", err)
+		}
+		seg.Motion = *changes.Motion
+	}
+	return out, nil
+}
+
+// SplitSegment splits a segment in two at a byte offset into its text.
+// Both halves keep the segment's image prompt and characters.
+func SplitSegment(segments []models.Segment, number, at int) ([]models.Segment, error) {
+	i, err := segmentIndex(segments, number)
+	if err != nil {
+		return nil, err
+	}
+	text := segments[i].Segment
+	if at <= 0 || at >= len(text) || !utf8.RuneStart(text[at]) {
+		return nil, editErrorf("split position must be inside the segment's %d characters", len(text))
+	}
+	first, second := strings.TrimSpace(text[:at]), strings.TrimSpace(text[at:])
+	if first == "" || second == "" {
+		return nil, editErrorf("both halves of a split need some text")
+	}
+
+	head := segments[i]
+	head.Segment = first
+	tail := segments[i]
+	tail.Model = gorm.Model{}
+	tail.Segment = second
+
+	out := append([]models.Segment{}, segments[:i]...)
+	out = append(out, head, tail)
+	return append(out, segments[i+1:]...), nil
+}
+
+// MergeSegments joins a segment with the one after it, keeping the first's
+// image prompt and the characters of both
+func MergeSegments(segments []models.Segment, number int) ([]models.Segment, error) {
+	i, err := segmentIndex(segments, number)
+	if err != nil {
+		return nil, err
+	}
+	if i+1 >= len(segments) {
+		return nil, editErrorf("segment %d is the last, there is nothing to merge it with", number)
+	}
+
+	merged := segments[i]
+	merged.Characters = append([]string(nil), merged.Characters...)
+	next := segments[i+1]
+	merged.Segment = strings.TrimSpace(merged.Segment) + " " + strings.TrimSpace(next.Segment)
+	for _, name := range next.Characters {
+		if !containsFold(merged.Characters, name) {
+			merged.Characters = append(merged.Characters, name)
+		}
+	}
+
+	out := append([]models.Segment{}, segments[:i]...)
+	out = append(out, merged)
+	return append(out, segments[i+2:]...), nil
+}
+
+// ReorderSegments puts the segments in the order of their numbers in order,
+// which must name every segment once
+func ReorderSegments(segments []models.Segment, order []int) ([]models.Segment, error) {
+	if len(order) != len(segments) {
+		return nil, editErrorf("the order must list all %d segments", len(segments))
+	}
+	out := make([]models.Segment, 0, len(segments))
+	seen := make(map[int]bool, len(order))
+	for _, number := range order {
+		if seen[number] {
+			return nil, editErrorf("segment %d is listed more than once", number)
+		}
+		seen[number] = true
+		i, err := segmentIndex(segments, number)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, segments[i])
+	}
+	return out, nil
+}
+
+// DeleteSegment removes a segment
+func DeleteSegment(segments []models.Segment, number int) ([]models.Segment, error) {
+	i, err := segmentIndex(segments, number)
+	if err != nil {
+		return nil, err
+	}
+	out := append([]models.Segment{}, segments[:i]...)
+	return append(out, segments[i+1:]...), nil
+}
+
+func containsFold(list []string, s string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// StartRender queues a draft story for rendering with its segments as they are
+func StartRender(story *models.Story) error {
+	result := database.DB.Model(story).
+		Where("status = ?", models.StatusDraft).
+		Updates(map[string]interface{}{
+			"draft":  false,
+			"status": models.StatusQueued,
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotDraft
+	}
+	return nil
+}
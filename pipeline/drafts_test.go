@@ -0,0 +1,102 @@
+package pipeline
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/1rvyn/halloween-story-generator/models"
+)
+
+func draftSegments(texts ...string) []models.Segment {
+	segments := make([]models.Segment, len(texts))
+	for i, text := range texts {
+		segments[i] = models.Segment{Number: i + 1, Segment: text}
+		segments[i].ID = uint(i + 10)
+	}
+	return segments
+}
+
+func segmentTexts(segments []models.Segment) []string {
+	texts := make([]string, len(segments))
+	for i, seg := range segments {
+		texts[i] = seg.Segment
+	}
+	return texts
+}
+
+func TestSplitSegment(t *testing.T) {
+	segments := draftSegments("One. Two.", "Three.")
+	segments[0].ImagePrompt = "A hallway"
+
+	got, err := SplitSegment(segments, 1, 4)
+	if err != nil {
+		t.Fatalf("Expected success, got error: %v", err)
+	}
+	if want := []string{"One.", "Two.", "Three."}; !reflect.DeepEqual(segmentTexts(got), want) {
+		t.Errorf("Split texts = %q, expected %q", segmentTexts(got), want)
+	}
+	if got[0].ID != 10 || got[1].ID != 0 || got[1].ImagePrompt != "A hallway" {
+		t.Errorf("Expected the second half to be a new segment with the same prompt, got %+v", got[1])
+	}
+
+	for _, tt := range []struct {
+		text string
+		at   int
+	}{
+		{"One. Two.", 0},
+		{"One. Two.", 9},
+		{" One", 1},  // Nothing before the split
+		{"Naïve", 3}, // Inside a character
+	} {
+		_, err := SplitSegment(draftSegments(tt.text), 1, tt.at)
+		var editErr *EditError
+		if !errors.As(err, &editErr) {
+			t.Errorf("Split %q at %d: expected an *EditError, got %v", tt.text, tt.at, err)
+		}
+	}
+}
+
+func TestMergeReorderDeleteSegments(t *testing.T) {
+	segments := draftSegments("One.", "Two.", "Three.")
+	segments[0].Characters = []string{"Tom"}
+	segments[1].Characters = []string{"tom", "Ana"}
+
+	merged, err := MergeSegments(segments, 1)
+	if err != nil {
+		t.Fatalf("Expected success, got error: %v", err)
+	}
+	if want := []string{"One. Two.", "Three."}; !reflect.DeepEqual(segmentTexts(merged), want) {
+		t.Errorf("Merged texts = %q, expected %q", segmentTexts(merged), want)
+	}
+	if want := []string{"Tom", "Ana"}; !reflect.DeepEqual(merged[0].Characters, want) {
+		t.Errorf("Merged characters = %q, expected %q", merged[0].Characters, want)
+	}
+	if _, err := MergeSegments(segments, 3); err == nil {
+		t.Error("Expected an error merging the last segment, got nil")
+	}
+
+	reordered, err := ReorderSegments(segments, []int{3, 1, 2})
+	if err != nil {
+		t.Fatalf("Expected success, got error: %v", err)
+	}
+	if want := []string{"Three.", "One.", "Two."}; !reflect.DeepEqual(segmentTexts(reordered), want) {
+		t.Errorf("Reordered texts = %q, expected %q", segmentTexts(reordered), want)
+	}
+	for _, order := range [][]int{{1, 2}, {1, 1, 2}, {1, 2, 4}} {
+		if _, err := ReorderSegments(segments, order); err == nil {
+			t.Errorf("Expected an error for order %v, got nil", order)
+		}
+	}
+
+	deleted, err := DeleteSegment(segments, 2)
+	if err != nil {
+		t.Fatalf("Expected success, got error: %v", err)
+	}
+	if want := []string{"One.", "Three."}; !reflect.DeepEqual(segmentTexts(deleted), want) {
+		t.Errorf("Texts after delete = %q, expected %q", segmentTexts(deleted), want)
+	}
+	if err := validateDraft(nil); err == nil {
+		t.Error("Expected deleting every segment to be rejected, got nil")
+	}
+}
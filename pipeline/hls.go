@@ -0,0 +1,80 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/1rvyn/halloween-story-generator/database"
+	"github.com/1rvyn/halloween-story-generator/misc"
+	"github.com/1rvyn/halloween-story-generator/models"
+	"github.com/1rvyn/halloween-story-generator/storage"
+)
+
+// hlsContentTypes are the files PackageHLS writes
+var hlsContentTypes = map[string]string{
+	".m3u8": "application/vnd.apple.mpegurl",
+	".ts":   "video/mp2t",
+}
+
+// uploadHLS packages the main video into HLS renditions and stores every
+// playlist and segment under a prefix for the story's version. Once the
+// story points at them, the files of earlier versions are deleted, so a
+// rerender with fewer segments leaves none behind.
+func uploadHLS(story *models.Story, profile misc.Profile, videoPath string) error {
+	dir, err := misc.PackageHLS(int(story.ID), videoPath, profile)
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	prefix := hlsPrefix(story.ID, story.Version)
+	err = filepath.WalkDir(dir, func(file string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+		contentType, ok := hlsContentTypes[filepath.Ext(file)]
+		if !ok {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, file)
+		if err != nil {
+			return err
+		}
+		return putFile(prefix+filepath.ToSlash(rel), file, contentType)
+	})
+	if err != nil {
+		return err
+	}
+
+	story.HLSKey = path.Join(prefix, misc.HLSMasterPlaylist)
+	if err := database.DB.Model(story).Select("hls_key").Updates(story).Error; err != nil {
+		return fmt.Errorf("updating story with HLS key: %w", err)
+	}
+
+	deleteHLS(story.ID, prefix)
+	return nil
+}
+
+// deleteHLS deletes a story's HLS files, except those under keep. An empty
+// keep deletes them all, for a story no longer packaged for streaming.
+func deleteHLS(storyID uint, keep string) {
+	keys, err := storage.Default.List(context.TODO(), hlsRoot(storyID))
+	if err != nil {
+		log.Printf("Warning: Failed to list old HLS files of story %d: %v", storyID, err)
+		return
+	}
+	for _, key := range keys {
+		if keep != "" && strings.HasPrefix(key, keep) {
+			continue
+		}
+		if err := deleteObject(key); err != nil {
+			log.Printf("Warning: Failed to delete old HLS file: %v", err)
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package pipeline
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/1rvyn/halloween-story-generator/storage"
+)
+
+func TestDeleteHLS(t *testing.T) {
+	store, err := storage.NewLocalStore(t.TempDir(), "http://localhost/files")
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	defer func(previous storage.BlobStore) { storage.Default = previous }(storage.Default)
+	storage.Default = store
+
+	for _, key := range []string{
+		hlsPrefix(1, 1) + "master.m3u8",
+		hlsPrefix(1, 2) + "master.m3u8",
+		hlsPrefix(1, 2) + "720p/segment_000.ts",
+		hlsPrefix(12, 1) + "master.m3u8",
+	} {
+		if err := store.Put(context.Background(), key, strings.NewReader("x"), "application/octet-stream"); err != nil {
+			t.Fatalf("Failed to store %s: %v", key, err)
+		}
+	}
+	list := func(storyID uint) []string {
+		keys, err := store.List(context.Background(), hlsRoot(storyID))
+		if err != nil {
+			t.Fatalf("Failed to list: %v", err)
+		}
+		return keys
+	}
+
+	// A rerender keeps only its own version
+	deleteHLS(1, hlsPrefix(1, 2))
+	if got, want := list(1), []string{hlsPrefix(1, 2) + "720p/segment_000.ts", hlsPrefix(1, 2) + "master.m3u8"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("After a rerender got %q, expected %q", got, want)
+	}
+
+	// Turning HLS off deletes every version, and no other story's files
+	deleteHLS(1, "")
+	if got := list(1); len(got) != 0 {
+		t.Errorf("Expected no HLS files once HLS is off, got %q", got)
+	}
+	if got := list(12); len(got) != 1 {
+		t.Errorf("Expected story 12's HLS files to be kept, got %q", got)
+	}
+}
@@ -0,0 +1,114 @@
+package pipeline
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"sync"
+
+	"github.com/1rvyn/halloween-story-generator/database"
+	"github.com/1rvyn/halloween-story-generator/imagegen"
+	"github.com/1rvyn/halloween-story-generator/misc"
+	"github.com/1rvyn/halloween-story-generator/models"
+)
+
+// generateImages makes sure every segment still waiting on a clip has an
+// image in memory for each aspect ratio the clips need, fetching stored
+// images and generating the rest with the story's image backend.
+func generateImages(story *models.Story, segments []models.Segment, profiles []misc.Profile) error {
+	generator, err := imagegen.New(story.ImageBackend, story.ImageModel)
+	if err != nil {
+		return err
+	}
+
+	var wg sync.WaitGroup
+	var mutex sync.Mutex
+	errChan := make(chan error, len(segments)*len(profiles))
+
+	for i := range segments {
+		seg := &segments[i]
+		seg.Images = make(map[string][]byte)
+		if seg.ImageKeys == nil {
+			seg.ImageKeys = make(map[string]string)
+		}
+
+		for _, aspect := range missingAspects(seg, profiles) {
+			wg.Add(1)
+			go func(seg *models.Segment, aspect string) {
+				defer wg.Done()
+
+				// Reuse the image from an earlier attempt if it made it into storage
+				mutex.Lock()
+				storedKey := seg.ImageKeys[aspect]
+				mutex.Unlock()
+				if storedKey != "" {
+					imageData, err := getObject(storedKey)
+					if err != nil {
+						errChan <- fmt.Errorf("fetching stored %s image for segment %d: %w", aspect, seg.Number, err)
+						return
+					}
+					mutex.Lock()
+					seg.Images[aspect] = imageData
+					mutex.Unlock()
+					return
+				}
+
+				log.Printf("Starting processing for segment %d at %s", seg.Number, aspect)
+				image, err := generator.Generate(context.TODO(), ImageRequest(story, seg, aspect))
+				if err != nil {
+					errChan <- fmt.Errorf("generating %s image for segment %d: %w", aspect, seg.Number, err)
+					return
+				}
+
+				// Upload the image to object storage
+				key := imageKey(story.ID, seg.Number, aspect, imagegen.Extension(image.ContentType))
+				if err := putObject(key, bytes.NewReader(image.Data), image.ContentType); err != nil {
+					errChan <- fmt.Errorf("uploading image for segment %d: %w", seg.Number, err)
+					return
+				}
+
+				// Update the segment with the stored image key, and keep the
+				// image data in memory for ffmpeg processing
+				mutex.Lock()
+				defer mutex.Unlock()
+				seg.ImageKeys[aspect] = key
+				seg.Images[aspect] = image.Data
+				if err := database.DB.Model(seg).Select("image_keys").Updates(seg).Error; err != nil {
+					errChan <- fmt.Errorf("updating segment %d with ImageKeys: %w", seg.Number, err)
+					return
+				}
+			}(seg, aspect)
+		}
+	}
+
+	wg.Wait()
+	close(errChan)
+
+	// Collect errors
+	var combinedErr error
+	for err := range errChan {
+		if combinedErr == nil {
+			combinedErr = err
+		} else {
+			combinedErr = fmt.Errorf("%v; %w", combinedErr, err)
+		}
+	}
+
+	return combinedErr
+}
+
+// missingAspects lists the aspect ratios of the profiles a segment still
+// needs a clip for. Once every clip is stored the images aren't needed again.
+func missingAspects(seg *models.Segment, profiles []misc.Profile) []string {
+	var aspects []string
+	seen := make(map[string]bool)
+	for _, profile := range profiles {
+		if seg.ClipKeys[profile.Name] != "" || seen[profile.AspectRatio] {
+			continue
+		}
+		seen[profile.AspectRatio] = true
+		aspects = append(aspects, profile.AspectRatio)
+	}
+	return aspects
+}
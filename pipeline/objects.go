@@ -0,0 +1,120 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/1rvyn/halloween-story-generator/storage"
+)
+
+// Object keys are derived from the story and segment, and recorded on the
+// story and segment rows once the object is stored.
+
+// imageKey takes the extension separately since it depends on the image backend
+func imageKey(storyID uint, number int, aspect, ext string) string {
+	return fmt.Sprintf("images/story_%d_segment_%d_%s%s", storyID, number, strings.ReplaceAll(aspect, ":", "x"), ext)
+}
+
+// audioKey takes the extension separately since it depends on the narrator
+func audioKey(storyID uint, number int, ext string) string {
+	return fmt.Sprintf("audio/story_%d_segment_%d%s", storyID, number, ext)
+}
+
+func clipKey(storyID uint, number int, profile string) string {
+	return fmt.Sprintf("clips/story_%d_segment_%d_%s.mp4", storyID, number, profile)
+}
+
+func videoKey(storyID uint, profile string) string {
+	return fmt.Sprintf("videos/story_%d_%s.mp4", storyID, profile)
+}
+
+// subtitleKey puts the subtitles next to the video, ext being .srt, .vtt or .ass
+func subtitleKey(storyID uint, ext string) string {
+	return fmt.Sprintf("videos/story_%d_video%s", storyID, ext)
+}
+
+func posterKey(storyID uint) string {
+	return fmt.Sprintf("posters/story_%d.jpg", storyID)
+}
+
+func previewKey(storyID uint, format string) string {
+	return fmt.Sprintf("previews/story_%d.%s", storyID, format)
+}
+
+// hlsRoot holds every packaging of a story's HLS renditions
+func hlsRoot(storyID uint) string {
+	return fmt.Sprintf("hls/story_%d/", storyID)
+}
+
+// hlsPrefix holds the HLS master playlist of one version of a story, and a
+// directory per rendition
+func hlsPrefix(storyID uint, version int) string {
+	return fmt.Sprintf("%sv%d/", hlsRoot(storyID), version)
+}
+
+func ambientUploadKey(userID, trackID uint, ext string) string {
+	return fmt.Sprintf("ambient/users/%d/track_%d%s", userID, trackID, ext)
+}
+
+// putObject uploads body to the object store. Objects are private, the API
+// hands out signed URLs for them.
+func putObject(key string, body io.Reader, contentType string) error {
+	if storage.Default == nil {
+		return fmt.Errorf("object storage is not initialized")
+	}
+
+	if err := storage.Default.Put(context.TODO(), key, body, contentType); err != nil {
+		return fmt.Errorf("uploading %s: %w", key, err)
+	}
+	return nil
+}
+
+// putFile uploads a local file to the object store
+func putFile(key, path, contentType string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return putObject(key, file, contentType)
+}
+
+// deleteObject removes an object from the object store
+func deleteObject(key string) error {
+	if storage.Default == nil {
+		return fmt.Errorf("object storage is not initialized")
+	}
+
+	if err := storage.Default.Delete(context.TODO(), key); err != nil {
+		return fmt.Errorf("deleting %s: %w", key, err)
+	}
+	return nil
+}
+
+// getObject downloads an object from the object store into memory
+func getObject(key string) ([]byte, error) {
+	if storage.Default == nil {
+		return nil, fmt.Errorf("object storage is not initialized")
+	}
+
+	body, err := storage.Default.Get(context.TODO(), key)
+	if err != nil {
+		return nil, fmt.Errorf("downloading %s: %w", key, err)
+	}
+	defer body.Close()
+
+	return io.ReadAll(body)
+}
+
+// getFile downloads an object from the object store to a local file
+func getFile(key, path string) error {
+	data, err := getObject(key)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
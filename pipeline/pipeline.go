@@ -0,0 +1,354 @@
+package pipeline
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/1rvyn/halloween-story-generator/database"
+	"github.com/1rvyn/halloween-story-generator/misc"
+	"github.com/1rvyn/halloween-story-generator/models"
+	"github.com/1rvyn/halloween-story-generator/narrator"
+)
+
+// Run takes a story from its submitted text all the way to an uploaded video,
+// recording each stage on the story as it goes.
+func Run(storyID uint) error {
+	var story models.Story
+	if err := database.DB.First(&story, storyID).Error; err != nil {
+		return fmt.Errorf("loading story %d: %w", storyID, err)
+	}
+
+	if err := run(&story); err != nil {
+		fail(&story, err)
+		return err
+	}
+	return nil
+}
+
+func run(story *models.Story) error {
+	startTime := time.Now()
+
+	profiles, err := misc.LookupProfiles(story.Profiles)
+	if err != nil {
+		return err
+	}
+
+	// Every stage checks what earlier attempts already stored, so a job that
+	// was interrupted or resumed only does the work that is still missing
+	var segments []models.Segment
+	if err := database.DB.Where("story_id = ?", story.ID).Order("number").Find(&segments).Error; err != nil {
+		return fmt.Errorf("loading segments: %w", err)
+	}
+
+	if len(segments) == 0 {
+		if err := setStatus(story, models.StatusSegmenting); err != nil {
+			return err
+		}
+		segments, err = segmentStory(story)
+		if err != nil {
+			return fmt.Errorf("segmenting story: %w", err)
+		}
+	}
+	defer removeSegmentFiles(segments)
+
+	if story.Draft {
+		log.Printf("Story %d segmented as a draft", story.ID)
+		return setStatus(story, models.StatusDraft)
+	}
+
+	if err := setStatus(story, models.StatusImaging); err != nil {
+		return err
+	}
+	if err := generateImages(story, segments, profiles); err != nil {
+		return fmt.Errorf("generating images: %w", err)
+	}
+
+	if err := setStatus(story, models.StatusNarrating); err != nil {
+		return err
+	}
+	if err := narrateSegments(story, segments, profiles); err != nil {
+		return fmt.Errorf("generating narration: %w", err)
+	}
+	deleteReplacedObjects(segments)
+
+	if err := setStatus(story, models.StatusRendering); err != nil {
+		return err
+	}
+	if err := renderClips(story, segments, profiles); err != nil {
+		return fmt.Errorf("rendering clips: %w", err)
+	}
+
+	ambientPath, err := fetchAmbient(story)
+	if err != nil {
+		return fmt.Errorf("fetching ambient track: %w", err)
+	}
+	if ambientPath != "" {
+		defer os.Remove(ambientPath)
+	}
+
+	videoPaths := make(map[string]string, len(profiles))
+	for _, profile := range profiles {
+		clipPaths := make([]string, len(segments))
+		for i, seg := range segments {
+			clipPaths[i] = seg.ClipPaths[profile.Name]
+		}
+		videoFilePath, err := misc.ConcatClips(int(story.ID), profile.Name, clipPaths, Transition(story))
+		if err != nil {
+			return fmt.Errorf("rendering %s video: %w", profile.Name, err)
+		}
+		defer os.Remove(videoFilePath)
+
+		if ambientPath != "" {
+			videoFilePath, err = misc.MixAmbient(int(story.ID), profile.Name, videoFilePath, ambientPath, story.AmbientVolume)
+			if err != nil {
+				return fmt.Errorf("mixing ambient sound into %s video: %w", profile.Name, err)
+			}
+			defer os.Remove(videoFilePath)
+		}
+		videoPaths[profile.Name] = videoFilePath
+	}
+
+	if err := setStatus(story, models.StatusUploading); err != nil {
+		return err
+	}
+	videoKeys := make(map[string]string, len(profiles))
+	for _, profile := range profiles {
+		key := videoKey(story.ID, profile.Name)
+		if err := putFile(key, videoPaths[profile.Name], "video/mp4"); err != nil {
+			return fmt.Errorf("uploading %s video: %w", profile.Name, err)
+		}
+		videoKeys[profile.Name] = key
+	}
+	if err := uploadSubtitles(story, segments, profiles[0]); err != nil {
+		return fmt.Errorf("uploading subtitles: %w", err)
+	}
+	if story.HLS {
+		if err := uploadHLS(story, profiles[0], videoPaths[profiles[0].Name]); err != nil {
+			return fmt.Errorf("packaging HLS: %w", err)
+		}
+	} else {
+		// Turned off since the last render, the old renditions go once the story stops pointing at them
+		story.HLSKey = ""
+	}
+	uploadPreviews(story, segments, profiles[0], videoPaths[profiles[0].Name])
+
+	story.VideoKey = videoKeys[profiles[0].Name]
+	story.VideoKeys = videoKeys
+	story.Status = models.StatusDone
+	story.Error = ""
+	if err := database.DB.Model(story).Select("video_key", "video_keys", "status", "error", "hls_key").Updates(story).Error; err != nil {
+		return fmt.Errorf("updating story with video keys: %w", err)
+	}
+	if !story.HLS {
+		deleteHLS(story.ID, "")
+	}
+
+	log.Printf("Story %d finished in %v", story.ID, time.Since(startTime))
+	return nil
+}
+
+// narrateSegments makes sure every segment still waiting on a clip has its
+// narration on local disk, fetching stored audio and generating the rest with
+// the story's narrator. New audio is stored even if other segments fail, so a
+// retry can reuse it.
+func narrateSegments(story *models.Story, segments []models.Segment, profiles []misc.Profile) error {
+	n, err := narrator.New(story.Narrator)
+	if err != nil {
+		return err
+	}
+
+	tempDir, err := misc.TempDirectory()
+	if err != nil {
+		return err
+	}
+
+	for i := range segments {
+		seg := &segments[i]
+		if seg.AudioKey == "" || hasClips(seg, profiles) {
+			continue
+		}
+		audioPath := filepath.Join(tempDir, fmt.Sprintf("story_%d_seg_%d_stored%s", story.ID, seg.Number, path.Ext(seg.AudioKey)))
+		if err := getFile(seg.AudioKey, audioPath); err != nil {
+			return fmt.Errorf("fetching stored audio for segment %d: %w", seg.Number, err)
+		}
+		seg.AudioPath = audioPath
+
+		// Audio stored before word timings were recorded
+		if len(seg.Words) == 0 {
+			seg.Words = misc.WordTimings(seg.Segment, audioPath, seg.Duration)
+			if err := database.DB.Model(seg).Select("words").Updates(seg).Error; err != nil {
+				return fmt.Errorf("updating segment %d with word timings: %w", seg.Number, err)
+			}
+		}
+	}
+
+	opts := narrator.Options{
+		Voice: story.Voice,
+		Speed: story.VoiceSpeed,
+		Model: story.VoiceModel,
+	}
+	narrateErr := misc.NarrateSegments(n, opts, int(story.ID), segments)
+
+	for i := range segments {
+		seg := &segments[i]
+		if seg.AudioPath == "" || seg.AudioKey != "" {
+			continue
+		}
+		ext := filepath.Ext(seg.AudioPath)
+		key := audioKey(story.ID, seg.Number, ext)
+		if err := putFile(key, seg.AudioPath, narrator.ContentType(strings.TrimPrefix(ext, "."))); err != nil {
+			return err
+		}
+		seg.AudioKey = key
+		// Updating from the struct so the word timings go through their JSON serializer
+		if err := database.DB.Model(seg).Select("audio_key", "duration", "words").Updates(seg).Error; err != nil {
+			return fmt.Errorf("updating segment %d with AudioKey: %w", seg.Number, err)
+		}
+	}
+
+	return narrateErr
+}
+
+// renderClips makes sure every segment has its clip for every profile on
+// local disk, fetching stored clips and rendering and storing the rest.
+func renderClips(story *models.Story, segments []models.Segment, profiles []misc.Profile) error {
+	tempDir, err := misc.TempDirectory()
+	if err != nil {
+		return err
+	}
+
+	storyID := story.ID
+	captions := CaptionStyle(story)
+
+	var wg sync.WaitGroup
+	var mutex sync.Mutex
+	sem := make(chan struct{}, 2) // Limit to 2 concurrent FFmpeg processes
+	errChan := make(chan error, len(segments)*len(profiles))
+
+	for i := range segments {
+		seg := &segments[i]
+		seg.ClipPaths = make(map[string]string)
+		if seg.ClipKeys == nil {
+			seg.ClipKeys = make(map[string]string)
+		}
+
+		for _, profile := range profiles {
+			wg.Add(1)
+			go func(idx int, seg *models.Segment, profile misc.Profile) {
+				defer wg.Done()
+
+				mutex.Lock()
+				storedKey := seg.ClipKeys[profile.Name]
+				mutex.Unlock()
+				if storedKey != "" {
+					clipPath := misc.ClipPath(tempDir, int(storyID), idx, profile.Name)
+					if err := getFile(storedKey, clipPath); err != nil {
+						errChan <- fmt.Errorf("fetching stored %s clip for segment %d: %w", profile.Name, seg.Number, err)
+						return
+					}
+					mutex.Lock()
+					seg.ClipPaths[profile.Name] = clipPath
+					mutex.Unlock()
+					return
+				}
+
+				sem <- struct{}{}
+				defer func() { <-sem }()
+
+				// Each profile renders from the image generated at its aspect ratio
+				mutex.Lock()
+				clipSeg := *seg
+				clipSeg.ImageData = seg.Images[profile.AspectRatio]
+				mutex.Unlock()
+
+				clipPath, err := misc.RenderSegmentClip(int(storyID), idx, clipSeg, misc.ClipOptions{
+					Profile:   profile,
+					Captions:  captions,
+					Motion:    SegmentMotion(story, &clipSeg),
+					FrameRate: story.FrameRate,
+				})
+				if err != nil {
+					errChan <- fmt.Errorf("rendering %s clip for segment %d: %w", profile.Name, seg.Number, err)
+					return
+				}
+				mutex.Lock()
+				seg.ClipPaths[profile.Name] = clipPath
+				mutex.Unlock()
+
+				key := clipKey(storyID, seg.Number, profile.Name)
+				if err := putFile(key, clipPath, "video/mp4"); err != nil {
+					errChan <- err
+					return
+				}
+
+				mutex.Lock()
+				defer mutex.Unlock()
+				seg.ClipKeys[profile.Name] = key
+				if err := database.DB.Model(seg).Select("clip_keys").Updates(seg).Error; err != nil {
+					errChan <- fmt.Errorf("updating segment %d with ClipKeys: %w", seg.Number, err)
+					return
+				}
+			}(i, seg, profile)
+		}
+	}
+
+	wg.Wait()
+	close(errChan)
+
+	for err := range errChan {
+		return err
+	}
+	return nil
+}
+
+// hasClips reports whether a segment's clip is stored for every profile
+func hasClips(seg *models.Segment, profiles []misc.Profile) bool {
+	for _, profile := range profiles {
+		if seg.ClipKeys[profile.Name] == "" {
+			return false
+		}
+	}
+	return true
+}
+
+// removeSegmentFiles cleans up the local audio and clip files for a story
+func removeSegmentFiles(segments []models.Segment) {
+	for _, seg := range segments {
+		paths := []string{seg.AudioPath}
+		for _, clipPath := range seg.ClipPaths {
+			paths = append(paths, clipPath)
+		}
+		for _, path := range paths {
+			if path == "" {
+				continue
+			}
+			if err := os.Remove(path); err != nil {
+				log.Printf("Warning: Failed to remove temporary file %s: %v", path, err)
+			}
+		}
+	}
+}
+
+func setStatus(story *models.Story, status string) error {
+	log.Printf("Story %d: %s", story.ID, status)
+	if err := database.DB.Model(story).Update("status", status).Error; err != nil {
+		return fmt.Errorf("updating story status to %s: %w", status, err)
+	}
+	return nil
+}
+
+func fail(story *models.Story, cause error) {
+	log.Printf("Story %d failed: %v", story.ID, cause)
+	if err := database.DB.Model(story).Updates(map[string]interface{}{
+		"status": models.StatusFailed,
+		"error":  cause.Error(),
+	}).Error; err != nil {
+		log.Printf("Error marking story %d as failed: %v", story.ID, err)
+	}
+}
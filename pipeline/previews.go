@@ -0,0 +1,87 @@
+package pipeline
+
+import (
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/1rvyn/halloween-story-generator/database"
+	"github.com/1rvyn/halloween-story-generator/misc"
+	"github.com/1rvyn/halloween-story-generator/models"
+)
+
+// uploadPreviews stores a poster, the first segment's image with the title
+// over it, and a short animated preview cut from the main video. They are
+// nice to have, so failures are logged rather than failing the story.
+func uploadPreviews(story *models.Story, segments []models.Segment, profile misc.Profile, videoPath string) {
+	updates := map[string]interface{}{}
+
+	if key, err := uploadPoster(story, segments, profile); err != nil {
+		log.Printf("Warning: Failed to make a poster for story %d: %v", story.ID, err)
+	} else {
+		updates["poster_key"] = key
+	}
+
+	if key, err := uploadPreview(story, videoPath); err != nil {
+		log.Printf("Warning: Failed to make a preview for story %d: %v", story.ID, err)
+	} else {
+		updates["preview_key"] = key
+	}
+
+	if len(updates) == 0 {
+		return
+	}
+	if err := database.DB.Model(story).Updates(updates).Error; err != nil {
+		log.Printf("Warning: Failed to update story %d with preview keys: %v", story.ID, err)
+	}
+}
+
+func uploadPoster(story *models.Story, segments []models.Segment, profile misc.Profile) (string, error) {
+	if len(segments) == 0 {
+		return "", fmt.Errorf("no segments")
+	}
+
+	// The image is only in memory if the first clip was rendered this time
+	first := segments[0]
+	image := first.Images[profile.AspectRatio]
+	if image == nil {
+		key := first.ImageKeys[profile.AspectRatio]
+		if key == "" {
+			return "", fmt.Errorf("first segment has no %s image", profile.AspectRatio)
+		}
+		var err error
+		if image, err = getObject(key); err != nil {
+			return "", err
+		}
+	}
+
+	title := story.Title
+	if title == "" {
+		title = misc.DefaultTitle(story.Content)
+	}
+
+	posterPath, err := misc.RenderPoster(int(story.ID), image, title, profile)
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(posterPath)
+
+	key := posterKey(story.ID)
+	return key, putFile(key, posterPath, "image/jpeg")
+}
+
+func uploadPreview(story *models.Story, videoPath string) (string, error) {
+	format := story.PreviewFormat
+	if format == "" {
+		format = "webp"
+	}
+
+	previewPath, err := misc.RenderPreview(int(story.ID), videoPath, format)
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(previewPath)
+
+	key := previewKey(story.ID, format)
+	return key, putFile(key, previewPath, "image/"+format)
+}
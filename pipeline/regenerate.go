@@ -0,0 +1,143 @@
+package pipeline
+
+import (
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/1rvyn/halloween-story-generator/database"
+	"github.com/1rvyn/halloween-story-generator/models"
+	"gorm.io/gorm"
+)
+
+// ErrStoryBusy is returned when a story is changed while the pipeline is still working on it
+var ErrStoryBusy = errors.New("story is still being made")
+
+// Asset sets cleared for a redo. A clip is made from its segment's image and
+// narration, so clearing either clears the clips too. The pipeline then only
+// redoes what is missing, and rebuilds the video from the segments' clips.
+const (
+	RedoImage = "image"
+	RedoAudio = "audio"
+	RedoClips = "clips"
+)
+
+// Redo clears the given assets of the story's segments and queues the story
+// to make them again, bumping its version. Only the segments with the given
+// numbers are cleared, or every segment when there are none. Finished or
+// failed stories can be redone, others return ErrStoryBusy.
+func Redo(story *models.Story, redo string, numbers ...int) error {
+	return redoWith(story, redo, nil, numbers...)
+}
+
+// RedoImageWithPrompts redoes a segment's image like Redo, drawing it from
+// new prompts, nil for those to keep. The prompts only change once the story
+// is claimed, so a busy story is left as it is.
+func RedoImageWithPrompts(story *models.Story, number int, imagePrompt, negativePrompt *string) error {
+	changes := map[string]interface{}{}
+	if imagePrompt != nil {
+		changes["image_prompt"] = *imagePrompt
+	}
+	if negativePrompt != nil {
+		changes["negative_prompt"] = *negativePrompt
+	}
+	return redoWith(story, RedoImage, func(tx *gorm.DB) error {
+		if len(changes) == 0 {
+			return nil
+		}
+		return tx.Model(&models.Segment{}).
+			Where("story_id = ? AND number = ?", story.ID, number).
+			Updates(changes).Error
+	}, number)
+}
+
+// redoWith is Redo, also making edit's changes to the segments after the
+// story is claimed
+func redoWith(story *models.Story, redo string, edit func(tx *gorm.DB) error, numbers ...int) error {
+	columns := map[string]interface{}{"clip_keys": gorm.Expr("'{}'::jsonb")}
+	switch redo {
+	case RedoImage:
+		columns["replaced_keys"] = gorm.Expr("COALESCE(replaced_keys, '[]'::jsonb) || " +
+			"CASE WHEN jsonb_typeof(image_keys) = 'object' " +
+			"THEN COALESCE((SELECT jsonb_agg(value) FROM jsonb_each_text(image_keys)), '[]'::jsonb) " +
+			"ELSE '[]'::jsonb END")
+		columns["image_keys"] = gorm.Expr("'{}'::jsonb")
+		// A new seed, or the same prompt would draw the same picture
+		columns["seed"] = newSeed()
+	case RedoAudio:
+		columns["replaced_keys"] = gorm.Expr("COALESCE(replaced_keys, '[]'::jsonb) || " +
+			"CASE WHEN audio_key <> '' THEN jsonb_build_array(audio_key) ELSE '[]'::jsonb END")
+		columns["audio_key"] = ""
+		columns["words"] = gorm.Expr("'[]'::jsonb")
+	case RedoClips:
+	default:
+		return fmt.Errorf("unknown redo %q", redo)
+	}
+
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		// Claim the story, so two redos can't run at once
+		result := tx.Model(story).
+			Where("status IN ?", []string{models.StatusDone, models.StatusFailed}).
+			Updates(map[string]interface{}{
+				"status":  models.StatusQueued,
+				"error":   "",
+				"version": gorm.Expr("version + 1"),
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrStoryBusy
+		}
+
+		if edit != nil {
+			if err := edit(tx); err != nil {
+				return err
+			}
+		}
+
+		query := tx.Model(&models.Segment{}).Where("story_id = ?", story.ID)
+		if len(numbers) > 0 {
+			query = query.Where("number IN ?", numbers)
+		}
+		if err := query.Updates(columns).Error; err != nil {
+			return fmt.Errorf("clearing segment %ss: %w", redo, err)
+		}
+
+		// Pick up the new version
+		return tx.First(story, story.ID).Error
+	})
+}
+
+// deleteReplacedObjects deletes the images and narration redos replaced, now
+// that their replacements are stored. A replacement stored under the same key
+// overwrote the old object, so keys still in use are kept. Objects that fail
+// to delete are left for the next run.
+func deleteReplacedObjects(segments []models.Segment) {
+	for i := range segments {
+		seg := &segments[i]
+		if len(seg.ReplacedKeys) == 0 {
+			continue
+		}
+
+		inUse := map[string]bool{seg.AudioKey: true}
+		for _, key := range seg.ImageKeys {
+			inUse[key] = true
+		}
+		var failed []string
+		for _, key := range seg.ReplacedKeys {
+			if inUse[key] {
+				continue
+			}
+			if err := deleteObject(key); err != nil {
+				log.Printf("Warning: Failed to delete replaced object: %v", err)
+				failed = append(failed, key)
+			}
+		}
+
+		seg.ReplacedKeys = failed
+		if err := database.DB.Model(seg).Select("replaced_keys").Updates(seg).Error; err != nil {
+			log.Printf("Warning: Failed to update replaced objects of segment %d: %v", seg.Number, err)
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/1rvyn/halloween-story-generator/database"
+	"github.com/1rvyn/halloween-story-generator/models"
+	"github.com/1rvyn/halloween-story-generator/segmenter"
+)
+
+// segmentStory splits the story with the configured segmenter and stores the segments
+func segmentStory(story *models.Story) ([]models.Segment, error) {
+	if segmenter.Default == nil {
+		return nil, errors.New("segmenter is not initialized")
+	}
+
+	parts, err := segmenter.Default.Segment(context.TODO(), story.Content)
+	if err != nil {
+		return nil, err
+	}
+
+	segments := make([]models.Segment, len(parts))
+	for i, part := range parts {
+		segments[i] = models.Segment{
+			StoryID:         int(story.ID),
+			Segment:         part.Text,
+			Number:          part.Number,
+			ImagePrompt:     part.ImagePrompt,
+			Mood:            part.Mood,
+			Characters:      part.Characters,
+			SuggestedMotion: part.CameraMotion,
+		}
+	}
+
+	if err := draftBible(story, parts, segments); err != nil {
+		return nil, err
+	}
+
+	// Create all the segments at once, so a resumed job either finds the full
+	// segmentation or none of it
+	if err := database.DB.Create(&segments).Error; err != nil {
+		return nil, fmt.Errorf("creating segments: %w", err)
+	}
+
+	return segments, nil
+}
@@ -0,0 +1,92 @@
+package pipeline
+
+import (
+	"fmt"
+
+	"github.com/1rvyn/halloween-story-generator/imagegen"
+	"github.com/1rvyn/halloween-story-generator/misc"
+	"github.com/1rvyn/halloween-story-generator/models"
+	"github.com/1rvyn/halloween-story-generator/narrator"
+)
+
+// ValidateSettings checks a new story's settings before it is queued, so
+// mistakes are reported to the user rather than failing the job later.
+// The story's CreatedBy must be set, uploaded ambient tracks are per user.
+func ValidateSettings(story *models.Story) error {
+	if _, err := imagegen.New(story.ImageBackend, story.ImageModel); err != nil {
+		return err
+	}
+	n, err := narrator.New(story.Narrator)
+	if err != nil {
+		return err
+	}
+	if err := n.CheckVoice(story.Voice); err != nil {
+		return err
+	}
+	if err := narrator.CheckSpeed(story.VoiceSpeed); err != nil {
+		return err
+	}
+	if _, err := misc.LookupProfiles(story.Profiles); err != nil {
+		return err
+	}
+	if err := misc.ValidateMotion(story.Motion); err != nil {
+		return err
+	}
+	if err := misc.ValidateFrameRate(story.FrameRate); err != nil {
+		return err
+	}
+	if err := Transition(story).Validate(); err != nil {
+		return err
+	}
+	if style := CaptionStyle(story); style != nil {
+		if err := style.Validate(); err != nil {
+			return err
+		}
+	}
+	if story.PreviewFormat != "" && story.PreviewFormat != "webp" && story.PreviewFormat != "gif" {
+		return fmt.Errorf("unknown preview format %q, expected webp or gif", story.PreviewFormat)
+	}
+	if _, err := AmbientKey(story); err != nil {
+		return err
+	}
+	if story.Bible != nil {
+		if err := ValidateBible(story.Bible); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CaptionStyle returns the burned-in caption style for a story, or nil when
+// the story only wants subtitle files
+func CaptionStyle(story *models.Story) *misc.CaptionStyle {
+	if !story.BurnCaptions {
+		return nil
+	}
+	style := storyCaptionStyle(story)
+	return &style
+}
+
+func storyCaptionStyle(story *models.Story) misc.CaptionStyle {
+	return misc.CaptionStyle{
+		Font:     story.CaptionFont,
+		Size:     story.CaptionSize,
+		Position: story.CaptionPosition,
+		Karaoke:  story.KaraokeCaptions,
+	}
+}
+
+// Transition returns how a story's clips are joined
+func Transition(story *models.Story) misc.Transition {
+	return misc.Transition{Name: story.Transition, Duration: story.TransitionSeconds}
+}
+
+// SegmentMotion returns a segment's camera motion. The segmenter's
+// suggestion only applies when neither the segment nor the story picks one.
+func SegmentMotion(story *models.Story, seg *models.Segment) string {
+	storyMotion := story.Motion
+	if storyMotion == "" || storyMotion == misc.MotionAuto {
+		storyMotion = seg.SuggestedMotion
+	}
+	return misc.ResolveMotion(seg.Motion, storyMotion, seg.Number)
+}
@@ -0,0 +1,64 @@
+package pipeline
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/1rvyn/halloween-story-generator/database"
+	"github.com/1rvyn/halloween-story-generator/misc"
+	"github.com/1rvyn/halloween-story-generator/models"
+)
+
+// uploadSubtitles stores SRT, WebVTT and ASS captions next to the video.
+// Every profile's clips run the same length, so one profile's will do. Timings
+// come from the rendered clips rather than the narration, so rounding to
+// whole frames doesn't make the captions drift.
+func uploadSubtitles(story *models.Story, segments []models.Segment, profile misc.Profile) error {
+	durations := make([]float64, len(segments))
+	for i, seg := range segments {
+		duration, err := misc.ProbeDuration(seg.ClipPaths[profile.Name])
+		if err != nil {
+			return fmt.Errorf("probing clip for segment %d: %w", seg.Number, err)
+		}
+		durations[i] = duration
+	}
+	starts := misc.NarrationStarts(durations, Transition(story))
+	cues := misc.StoryCues(segments, starts, durations)
+
+	// The ASS script is for karaoke players, so it highlights words whenever
+	// it can, whatever the burned-in captions do
+	assStyle := storyCaptionStyle(story)
+	assStyle.Karaoke = true
+	assStyle.Width, assStyle.Height = profile.Width, profile.Height
+
+	var srt, vtt, ass bytes.Buffer
+	if err := misc.WriteSRT(&srt, cues); err != nil {
+		return err
+	}
+	if err := misc.WriteVTT(&vtt, cues); err != nil {
+		return err
+	}
+	if err := misc.WriteASS(&ass, cues, assStyle); err != nil {
+		return err
+	}
+
+	srtKey, vttKey, assKey := subtitleKey(story.ID, ".srt"), subtitleKey(story.ID, ".vtt"), subtitleKey(story.ID, ".ass")
+	if err := putObject(srtKey, &srt, "application/x-subrip"); err != nil {
+		return err
+	}
+	if err := putObject(vttKey, &vtt, "text/vtt"); err != nil {
+		return err
+	}
+	if err := putObject(assKey, &ass, "text/x-ssa"); err != nil {
+		return err
+	}
+
+	if err := database.DB.Model(story).Updates(map[string]interface{}{
+		"srt_key": srtKey,
+		"vtt_key": vttKey,
+		"ass_key": assKey,
+	}).Error; err != nil {
+		return fmt.Errorf("updating story with subtitle keys: %w", err)
+	}
+	return nil
+}
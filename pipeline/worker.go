@@ -0,0 +1,72 @@
+package pipeline
+
+import (
+	"errors"
+	"log"
+
+	"github.com/1rvyn/halloween-story-generator/database"
+	"github.com/1rvyn/halloween-story-generator/models"
+)
+
+// ErrQueueFull is returned by Enqueue when every worker is busy and the backlog is full
+var ErrQueueFull = errors.New("story queue is full")
+
+const queueSize = 100
+
+var jobs chan uint
+
+// Start launches the worker pool and re-queues any stories that were still
+// in progress when the server last stopped. It should be called once during
+// application startup, after the database is connected.
+func Start(workers int) error {
+	if workers < 1 {
+		workers = 1
+	}
+	jobs = make(chan uint, queueSize)
+
+	for i := 0; i < workers; i++ {
+		go worker(i + 1)
+	}
+
+	var unfinished []models.Story
+	if err := database.DB.Where("status IN ?", []string{
+		models.StatusQueued,
+		models.StatusSegmenting,
+		models.StatusImaging,
+		models.StatusNarrating,
+		models.StatusRendering,
+		models.StatusUploading,
+	}).Order("id").Find(&unfinished).Error; err != nil {
+		return err
+	}
+
+	// Send from a goroutine so a large backlog can't block startup
+	go func() {
+		for _, story := range unfinished {
+			log.Printf("Re-queueing story %d (was %s)", story.ID, story.Status)
+			jobs <- story.ID
+		}
+	}()
+
+	log.Printf("Started %d story workers", workers)
+	return nil
+}
+
+// Enqueue hands a story to the worker pool without waiting for it to run
+func Enqueue(storyID uint) error {
+	select {
+	case jobs <- storyID:
+		return nil
+	default:
+		return ErrQueueFull
+	}
+}
+
+func worker(n int) {
+	for storyID := range jobs {
+		log.Printf("Worker %d picked up story %d", n, storyID)
+		if err := Run(storyID); err != nil {
+			log.Printf("Worker %d: story %d failed: %v", n, storyID, err)
+		}
+	}
+}
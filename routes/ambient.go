@@ -0,0 +1,81 @@
+package routes
+
+import (
+	"log"
+	"path/filepath"
+	"strings"
+
+	"github.com/1rvyn/halloween-story-generator/database"
+	"github.com/1rvyn/halloween-story-generator/models"
+	"github.com/1rvyn/halloween-story-generator/pipeline"
+	"github.com/gofiber/fiber/v2"
+)
+
+// maxAmbientUpload is the largest ambient track a user can upload
+const maxAmbientUpload = 20 * 1024 * 1024
+
+// GetAmbientTracks handles GET /api/ambient, listing the shared library
+// tracks by name and the user's own uploads by ID
+func GetAmbientTracks(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(uint)
+	if !ok {
+		return fiber.NewError(fiber.StatusUnauthorized, "Unauthorized")
+	}
+
+	library, err := pipeline.AmbientLibrary(c.Context())
+	if err != nil {
+		log.Printf("Error listing ambient library: %v", err)
+		return fiber.NewError(fiber.StatusInternalServerError, "Internal Server Error")
+	}
+
+	var uploads []models.AmbientTrack
+	if err := database.DB.Where("created_by = ? AND key <> ''", userID).Find(&uploads).Error; err != nil {
+		log.Printf("Error fetching ambient tracks for user %d: %v", userID, err)
+		return fiber.NewError(fiber.StatusInternalServerError, "Internal Server Error")
+	}
+
+	return c.JSON(fiber.Map{
+		"library": library,
+		"uploads": uploads,
+	})
+}
+
+// UploadAmbientTrack handles POST /api/ambient, a multipart form with the
+// audio in "file" and an optional "name"
+func UploadAmbientTrack(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(uint)
+	if !ok {
+		return fiber.NewError(fiber.StatusUnauthorized, "Unauthorized")
+	}
+
+	header, err := c.FormFile("file")
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Expected an audio file in the file field")
+	}
+	if header.Size > maxAmbientUpload {
+		return fiber.NewError(fiber.StatusRequestEntityTooLarge, "Ambient tracks can be at most 20MB")
+	}
+	contentType := header.Header.Get("Content-Type")
+	if !strings.HasPrefix(contentType, "audio/") {
+		return fiber.NewError(fiber.StatusUnsupportedMediaType, "Ambient tracks must be audio files")
+	}
+
+	name := c.FormValue("name")
+	if name == "" {
+		name = strings.TrimSuffix(header.Filename, filepath.Ext(header.Filename))
+	}
+
+	file, err := header.Open()
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Could not read the uploaded file")
+	}
+	defer file.Close()
+
+	track, err := pipeline.StoreAmbientTrack(userID, name, strings.ToLower(filepath.Ext(header.Filename)), file, contentType)
+	if err != nil {
+		log.Printf("Error storing ambient track for user %d: %v", userID, err)
+		return fiber.NewError(fiber.StatusInternalServerError, "Internal Server Error")
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(track)
+}
@@ -12,7 +12,9 @@ import (
 	"log"
 	"strings"
 
+	"github.com/1rvyn/halloween-story-generator/auth"
 	"github.com/1rvyn/halloween-story-generator/database"
+	"github.com/1rvyn/halloween-story-generator/middleware"
 	"github.com/1rvyn/halloween-story-generator/models"
 	"github.com/gofiber/fiber/v2"
 	"golang.org/x/oauth2"
@@ -28,18 +30,9 @@ type Auth0SignupResponse struct {
 	Email  string `json:"email"`
 }
 
-var (
-	auth0OauthConfig = &oauth2.Config{
-		RedirectURL:  os.Getenv("AUTH0_CALLBACK_URL"),
-		ClientID:     os.Getenv("AUTH0_CLIENT_ID"),
-		ClientSecret: os.Getenv("AUTH0_CLIENT_SECRET"),
-		Scopes:       []string{"openid", "profile", "email"},
-		Endpoint: oauth2.Endpoint{
-			AuthURL:  fmt.Sprintf("https://%s/authorize", os.Getenv("AUTH0_DOMAIN")),
-			TokenURL: fmt.Sprintf("https://%s/oauth/token", os.Getenv("AUTH0_DOMAIN")),
-		},
-	}
-	oauthStateString = "random"
+const (
+	loginStateCookie = "oauth_state"
+	loginStateTTL    = 10 * time.Minute
 )
 
 // func SignupPage(c *fiber.Ctx) error {
@@ -114,26 +107,64 @@ func getManagementAPIToken() string {
 }
 
 func LoginWithGoogle(c *fiber.Ctx) error {
-	url := auth0OauthConfig.AuthCodeURL(oauthStateString,
+	returnTo := auth.SafeReturnTo(c.Query("return_to"), strings.Split(os.Getenv("RETURN_TO_ORIGINS"), ","))
+	login, err := auth.NewLoginState(returnTo, loginStateTTL)
+	if err != nil {
+		return err
+	}
+	value, err := auth.Seal(login)
+	if err != nil {
+		return err
+	}
+	c.Cookie(&fiber.Cookie{
+		Name:     loginStateCookie,
+		Value:    value,
+		Path:     "/callback",
+		MaxAge:   int(loginStateTTL.Seconds()),
+		HTTPOnly: true,
+		SameSite: "Lax", // Sent on the redirect back from Auth0
+		Secure:   true,
+	})
+
+	url := auth.Config.AuthCodeURL(login.State,
 		oauth2.SetAuthURLParam("connection", "google-oauth2"),
 		oauth2.SetAuthURLParam("audience", os.Getenv("AUTH0_AUDIENCE")), // Add audience parameter
+		oauth2.S256ChallengeOption(login.Verifier),
 	)
 	return c.Redirect(url)
 }
 
 func Callback(c *fiber.Ctx) error {
-	state := c.Query("state")
-	if state != oauthStateString {
+	// The login cookie is single use
+	var login auth.LoginState
+	err := auth.Open(c.Cookies(loginStateCookie), &login)
+	c.Cookie(&fiber.Cookie{
+		Name:     loginStateCookie,
+		Path:     "/callback",
+		Expires:  time.Unix(0, 0),
+		HTTPOnly: true,
+		SameSite: "Lax",
+		Secure:   true,
+	})
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).SendString("Invalid oauth state")
+	}
+	if err := login.Check(c.Query("state")); err != nil {
+		log.Printf("Rejected login callback: %v", err)
 		return c.Status(fiber.StatusBadRequest).SendString("Invalid oauth state")
 	}
+	if authErr := c.Query("error"); authErr != "" {
+		log.Printf("Login failed: %s: %s", authErr, c.Query("error_description"))
+		return c.Status(fiber.StatusUnauthorized).SendString("Login failed")
+	}
 
 	code := c.Query("code")
-	token, err := auth0OauthConfig.Exchange(context.Background(), code)
+	token, err := auth.Config.Exchange(context.Background(), code, oauth2.VerifierOption(login.Verifier))
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).SendString("Code exchange failed")
 	}
 
-	client := auth0OauthConfig.Client(context.Background(), token)
+	client := auth.Config.Client(context.Background(), token)
 	resp, err := client.Get(fmt.Sprintf("https://%s/userinfo", os.Getenv("AUTH0_DOMAIN")))
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).SendString("Failed getting user info")
@@ -171,18 +202,22 @@ func Callback(c *fiber.Ctx) error {
 		}
 	}
 
-	// Set a cookie with the JWT token
-	c.Cookie(&fiber.Cookie{
-		Name:     "jwt",
-		Value:    token.AccessToken,
-		Expires:  time.Now().Add(time.Hour * 24),
-		HTTPOnly: true,
-		SameSite: "Lax",
-		Secure:   true,
-	})
+	// Keep the tokens in a session, and give the browser the access token
+	if err := middleware.StartSession(c, user.ID, user.Auth0ID, token); err != nil {
+		log.Printf("Failed to start session: %v", err)
+		return c.Status(fiber.StatusInternalServerError).SendString("Failed to start session")
+	}
 
-	// Redirect to the correct dashboard route
-	return c.Redirect("/dashboard") // Now correctly protected by JWT
+	// Back to where the login started, checked when it did
+	return c.Redirect(login.ReturnTo)
+}
+
+// Logout ends the login session, revoking its refresh token
+func Logout(c *fiber.Ctx) error {
+	if err := middleware.EndSession(c); err != nil {
+		return err
+	}
+	return c.JSON(fiber.Map{"message": "Logged out"})
 }
 
 // // ViewStory handles the GET /story route
@@ -0,0 +1,50 @@
+package routes
+
+import (
+	"log"
+
+	"github.com/1rvyn/halloween-story-generator/database"
+	"github.com/1rvyn/halloween-story-generator/models"
+	"github.com/1rvyn/halloween-story-generator/pipeline"
+	"github.com/gofiber/fiber/v2"
+)
+
+// GetStoryBible handles GET /api/story/:id/bible, the story's art style and
+// recurring characters
+func GetStoryBible(c *fiber.Ctx) error {
+	story, err := findUserStory(c)
+	if err != nil {
+		return err
+	}
+	if story.Bible == nil {
+		return fiber.NewError(fiber.StatusNotFound, "Story bible not ready")
+	}
+	return c.JSON(story.Bible)
+}
+
+// UpdateStoryBible handles PUT /api/story/:id/bible, replacing the story's
+// bible. Characters without a seed get one. Images already generated keep
+// the old look, the bible applies to images generated from now on.
+func UpdateStoryBible(c *fiber.Ctx) error {
+	story, err := findUserStory(c)
+	if err != nil {
+		return err
+	}
+
+	bible := new(models.StoryBible)
+	if err := c.BodyParser(bible); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Cannot parse JSON")
+	}
+	if err := pipeline.ValidateBible(bible); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+	bible.ArtStyle = pipeline.ArtStyle(bible.ArtStyle)
+	pipeline.AssignSeeds(bible)
+
+	story.Bible = bible
+	if err := database.DB.Model(story).Select("bible").Updates(story).Error; err != nil {
+		log.Printf("Error updating bible of story %d: %v", story.ID, err)
+		return fiber.NewError(fiber.StatusInternalServerError, "Internal Server Error")
+	}
+	return c.JSON(bible)
+}
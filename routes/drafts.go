@@ -0,0 +1,144 @@
+package routes
+
+import (
+	"errors"
+	"log"
+
+	"github.com/1rvyn/halloween-story-generator/database"
+	"github.com/1rvyn/halloween-story-generator/models"
+	"github.com/1rvyn/halloween-story-generator/pipeline"
+	"github.com/gofiber/fiber/v2"
+)
+
+// GetStorySegments handles GET /api/story/:id/segments
+func GetStorySegments(c *fiber.Ctx) error {
+	story, err := findUserStory(c)
+	if err != nil {
+		return err
+	}
+
+	var segments []models.Segment
+	if err := database.DB.Where("story_id = ?", story.ID).Order("number").Find(&segments).Error; err != nil {
+		log.Printf("Error fetching segments of story %d: %v", story.ID, err)
+		return fiber.NewError(fiber.StatusInternalServerError, "Internal Server Error")
+	}
+	return c.JSON(segments)
+}
+
+// UpdateSegment handles PATCH /api/story/:id/segments/:n, editing a draft
+// segment's text, image prompts or camera motion
+func UpdateSegment(c *fiber.Ctx) error {
+	var changes pipeline.SegmentChanges
+	if err := c.BodyParser(&changes); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Cannot parse JSON")
+	}
+	number, err := segmentNumber(c)
+	if err != nil {
+		return err
+	}
+	return editDraft(c, func(segments []models.Segment) ([]models.Segment, error) {
+		return pipeline.ChangeSegment(segments, number, changes)
+	})
+}
+
+// SplitSegment handles POST /api/story/:id/segments/:n/split with
+// {"at": 120}, splitting a draft segment at a byte offset into its text
+func SplitSegment(c *fiber.Ctx) error {
+	var body struct {
+		At int `json:"at"`
+	}
+	if err := c.BodyParser(&body); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Cannot parse JSON")
+	}
+	number, err := segmentNumber(c)
+	if err != nil {
+		return err
+	}
+	return editDraft(c, func(segments []models.Segment) ([]models.Segment, error) {
+		return pipeline.SplitSegment(segments, number, body.At)
+	})
+}
+
+// MergeSegment handles POST /api/story/:id/segments/:n/merge, joining a
+// draft segment with the next one
+func MergeSegment(c *fiber.Ctx) error {
+	number, err := segmentNumber(c)
+	if err != nil {
+		return err
+	}
+	return editDraft(c, func(segments []models.Segment) ([]models.Segment, error) {
+		return pipeline.MergeSegments(segments, number)
+	})
+}
+
+// DeleteSegment handles DELETE /api/story/:id/segments/:n
+func DeleteSegment(c *fiber.Ctx) error {
+	number, err := segmentNumber(c)
+	if err != nil {
+		return err
+	}
+	return editDraft(c, func(segments []models.Segment) ([]models.Segment, error) {
+		return pipeline.DeleteSegment(segments, number)
+	})
+}
+
+// ReorderSegments handles POST /api/story/:id/segments/reorder with
+// {"order": [2, 1, 3]}, the segment numbers in their new order
+func ReorderSegments(c *fiber.Ctx) error {
+	var body struct {
+		Order []int `json:"order"`
+	}
+	if err := c.BodyParser(&body); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Cannot parse JSON")
+	}
+	return editDraft(c, func(segments []models.Segment) ([]models.Segment, error) {
+		return pipeline.ReorderSegments(segments, body.Order)
+	})
+}
+
+// RenderStory handles POST /api/story/:id/render, making the video from a
+// draft story's segments as they now are
+func RenderStory(c *fiber.Ctx) error {
+	story, err := findUserStory(c)
+	if err != nil {
+		return err
+	}
+	if err := pipeline.StartRender(story); err != nil {
+		if errors.Is(err, pipeline.ErrNotDraft) {
+			return fiber.NewError(fiber.StatusConflict, "Only draft stories can be rendered")
+		}
+		log.Printf("Error starting render of story %d: %v", story.ID, err)
+		return fiber.NewError(fiber.StatusInternalServerError, "Internal Server Error")
+	}
+	return enqueueStory(c, story)
+}
+
+func segmentNumber(c *fiber.Ctx) (int, error) {
+	number, err := c.ParamsInt("n")
+	if err != nil || number <= 0 {
+		return 0, fiber.NewError(fiber.StatusBadRequest, "Invalid segment number")
+	}
+	return number, nil
+}
+
+// editDraft applies an edit to the draft story's segments and responds with
+// the segments as they now are
+func editDraft(c *fiber.Ctx, edit func([]models.Segment) ([]models.Segment, error)) error {
+	story, err := findUserStory(c)
+	if err != nil {
+		return err
+	}
+
+	segments, err := pipeline.EditDraft(story, edit)
+	var editErr *pipeline.EditError
+	switch {
+	case errors.As(err, &editErr):
+		return fiber.NewError(fiber.StatusBadRequest, editErr.Error())
+	case errors.Is(err, pipeline.ErrNotDraft):
+		return fiber.NewError(fiber.StatusConflict, "Only draft stories can be edited")
+	case err != nil:
+		log.Printf("Error editing segments of story %d: %v", story.ID, err)
+		return fiber.NewError(fiber.StatusInternalServerError, "Internal Server Error")
+	}
+	return c.JSON(segments)
+}
@@ -0,0 +1,102 @@
+package routes
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/1rvyn/halloween-story-generator/database"
+	"github.com/1rvyn/halloween-story-generator/misc"
+	"github.com/1rvyn/halloween-story-generator/models"
+	"github.com/1rvyn/halloween-story-generator/storage"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// hlsURLTTL is how long an HLS link works. Players fetch segments as they go,
+// so it has to outlast watching the video.
+const hlsURLTTL = 2 * time.Hour
+
+// hlsScope is what an HLS link's signature covers: every playlist of the story
+func hlsScope(storyID uint) string {
+	return fmt.Sprintf("hls/%d", storyID)
+}
+
+// hlsURL links to one of a story's playlists, carrying the signature along
+func hlsURL(storyID uint, playlist, query string) string {
+	return fmt.Sprintf("/hls/%d/%s?%s", storyID, playlist, query)
+}
+
+// signHLSURL returns a link to the story's HLS master playlist
+func signHLSURL(story *models.Story) string {
+	return hlsURL(story.ID, misc.HLSMasterPlaylist, storage.URLSigner.Sign(hlsScope(story.ID), hlsURLTTL).Encode())
+}
+
+// GetHLSPlaylist handles GET /hls/:id/*. Objects are private, so the story's
+// playlists are served through the app, which signs the link to each segment
+// and passes its own signature on to the variant playlists. The signature is
+// the only access check, since players can't send the auth header.
+func GetHLSPlaylist(c *fiber.Ctx) error {
+	storyID, err := c.ParamsInt("id")
+	if err != nil || storyID <= 0 {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid story ID")
+	}
+	if !storage.URLSigner.Verify(hlsScope(uint(storyID)), c.Query("expires"), c.Query("signature")) {
+		return fiber.NewError(fiber.StatusForbidden, "Invalid or expired link")
+	}
+
+	playlist := path.Clean(c.Params("*"))
+	if path.Ext(playlist) != ".m3u8" || strings.HasPrefix(playlist, "..") || path.IsAbs(playlist) {
+		return fiber.NewError(fiber.StatusNotFound, "Not found")
+	}
+
+	var story models.Story
+	err = database.DB.First(&story, storyID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) || err == nil && story.HLSKey == "" {
+		return fiber.NewError(fiber.StatusNotFound, "Not found")
+	}
+	if err != nil {
+		log.Printf("Error fetching story %d: %v", storyID, err)
+		return fiber.NewError(fiber.StatusInternalServerError, "Internal Server Error")
+	}
+
+	// The playlists of the story's current version, next to its master playlist
+	prefix := path.Dir(story.HLSKey) + "/"
+	body, err := storage.Default.Get(c.Context(), prefix+playlist)
+	if err != nil {
+		log.Printf("Error fetching playlist %s of story %d: %v", playlist, story.ID, err)
+		return fiber.NewError(fiber.StatusNotFound, "Not found")
+	}
+	defer body.Close()
+	data, err := io.ReadAll(body)
+	if err != nil {
+		log.Printf("Error reading playlist %s of story %d: %v", playlist, story.ID, err)
+		return fiber.NewError(fiber.StatusInternalServerError, "Internal Server Error")
+	}
+
+	// Variant playlists come back here with the same signature, segments go
+	// straight to the object store
+	token := c.Request().URI().QueryArgs().String()
+	rewritten, err := misc.RewritePlaylist(data, func(uri string) (string, error) {
+		target := path.Join(path.Dir(playlist), uri)
+		if strings.HasPrefix(target, "..") {
+			return "", fmt.Errorf("playlist entry %q is outside the story", uri)
+		}
+		if path.Ext(target) == ".m3u8" {
+			return hlsURL(story.ID, target, token), nil
+		}
+		return storage.Default.SignedURL(c.Context(), prefix+target, hlsURLTTL)
+	})
+	if err != nil {
+		log.Printf("Error rewriting playlist %s of story %d: %v", playlist, story.ID, err)
+		return fiber.NewError(fiber.StatusInternalServerError, "Internal Server Error")
+	}
+
+	c.Set(fiber.HeaderContentType, "application/vnd.apple.mpegurl")
+	c.Set(fiber.HeaderCacheControl, "no-store")
+	return c.Send(rewritten)
+}
@@ -0,0 +1,176 @@
+package routes
+
+import (
+	"errors"
+	"log"
+	"time"
+
+	"github.com/1rvyn/halloween-story-generator/database"
+	"github.com/1rvyn/halloween-story-generator/misc"
+	"github.com/1rvyn/halloween-story-generator/models"
+	"github.com/1rvyn/halloween-story-generator/storage"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// signedURLTTL is how long the links handed out for private objects work
+const signedURLTTL = 15 * time.Minute
+
+// GetStoryVideo handles GET /api/story/:id/video. It responds with a
+// short-lived link to the video, or redirects to it when ?redirect=true.
+// ?profile=vertical picks one of the story's other output profiles.
+func GetStoryVideo(c *fiber.Ctx) error {
+	story, err := findUserStory(c)
+	if err != nil {
+		return err
+	}
+
+	key := story.VideoKey
+	if profile := c.Query("profile"); profile != "" {
+		key = story.VideoKeys[profile]
+	}
+	if key == "" {
+		return fiber.NewError(fiber.StatusNotFound, "Video not ready")
+	}
+
+	return sendSignedURL(c, key)
+}
+
+// GetStorySubtitles handles GET /api/story/:id/subtitles?format=vtt, working
+// the same way as GetStoryVideo. The format is vtt (default), srt or ass.
+func GetStorySubtitles(c *fiber.Ctx) error {
+	story, err := findUserStory(c)
+	if err != nil {
+		return err
+	}
+
+	var key string
+	switch c.Query("format", "vtt") {
+	case "vtt":
+		key = story.VTTKey
+	case "srt":
+		key = story.SRTKey
+	case "ass":
+		key = story.ASSKey
+	default:
+		return fiber.NewError(fiber.StatusBadRequest, "Unknown subtitle format, expected vtt, srt or ass")
+	}
+	if key == "" {
+		return fiber.NewError(fiber.StatusNotFound, "Subtitles not ready")
+	}
+
+	return sendSignedURL(c, key)
+}
+
+// GetSegmentImage handles GET /api/story/:id/segments/:n/image, working the
+// same way as GetStoryVideo. The image is the one for the profile's aspect ratio.
+func GetSegmentImage(c *fiber.Ctx) error {
+	story, err := findUserStory(c)
+	if err != nil {
+		return err
+	}
+
+	profiles, err := misc.LookupProfiles(story.Profiles)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Internal Server Error")
+	}
+	profile := profiles[0]
+	if name := c.Query("profile"); name != "" {
+		found, err := misc.LookupProfiles([]string{name})
+		if err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, err.Error())
+		}
+		profile = found[0]
+	}
+
+	segment, err := findStorySegment(c, story)
+	if err != nil {
+		return err
+	}
+	key := segment.ImageKeys[profile.AspectRatio]
+	if key == "" {
+		return fiber.NewError(fiber.StatusNotFound, "Image not ready")
+	}
+
+	return sendSignedURL(c, key)
+}
+
+// findStorySegment loads the story's segment named by the :n route
+// parameter. Errors are *fiber.Error, as with findUserStory.
+func findStorySegment(c *fiber.Ctx, story *models.Story) (*models.Segment, error) {
+	number, err := c.ParamsInt("n")
+	if err != nil || number <= 0 {
+		return nil, fiber.NewError(fiber.StatusBadRequest, "Invalid segment number")
+	}
+
+	var segment models.Segment
+	err = database.DB.Where("story_id = ? AND number = ?", story.ID, number).First(&segment).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, fiber.NewError(fiber.StatusNotFound, "Segment not found")
+	}
+	if err != nil {
+		log.Printf("Error fetching segment %d of story %d: %v", number, story.ID, err)
+		return nil, fiber.NewError(fiber.StatusInternalServerError, "Internal Server Error")
+	}
+	return &segment, nil
+}
+
+func sendSignedURL(c *fiber.Ctx, key string) error {
+	expiresAt := time.Now().Add(signedURLTTL)
+	url, err := storage.Default.SignedURL(c.Context(), key, signedURLTTL)
+	if err != nil {
+		log.Printf("Error signing URL for %s: %v", key, err)
+		return fiber.NewError(fiber.StatusInternalServerError, "Internal Server Error")
+	}
+
+	if c.QueryBool("redirect") {
+		return c.Redirect(url, fiber.StatusFound)
+	}
+	return c.JSON(fiber.Map{
+		"url":        url,
+		"expires_at": expiresAt.UTC(),
+	})
+}
+
+// signStoryURLs fills in the story's links to its video, poster, preview and
+// HLS playlist with short-lived signed URLs, for whichever are ready. Failing
+// to sign only leaves a link out.
+func signStoryURLs(c *fiber.Ctx, story *models.Story) {
+	for _, link := range []struct {
+		key string
+		url *string
+	}{
+		{story.VideoKey, &story.VideoURL},
+		{story.PosterKey, &story.PosterURL},
+		{story.PreviewKey, &story.PreviewURL},
+	} {
+		if link.key == "" {
+			continue
+		}
+		url, err := storage.Default.SignedURL(c.Context(), link.key, signedURLTTL)
+		if err != nil {
+			log.Printf("Error signing URL for %s of story %d: %v", link.key, story.ID, err)
+			continue
+		}
+		*link.url = url
+	}
+	if story.HLSKey != "" {
+		story.HLSURL = signHLSURL(story)
+	}
+}
+
+// LocalFiles serves a LocalStore's files to requests signed by its SignedURL
+func LocalFiles(store *storage.LocalStore) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		key := c.Params("*")
+		if !store.Verify(key, c.Query("expires"), c.Query("signature")) {
+			return fiber.NewError(fiber.StatusForbidden, "Invalid or expired link")
+		}
+
+		path, err := store.Path(key)
+		if err != nil {
+			return fiber.NewError(fiber.StatusNotFound, "Not found")
+		}
+		return c.SendFile(path)
+	}
+}
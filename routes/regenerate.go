@@ -0,0 +1,101 @@
+package routes
+
+import (
+	"errors"
+	"log"
+
+	"github.com/1rvyn/halloween-story-generator/database"
+	"github.com/1rvyn/halloween-story-generator/models"
+	"github.com/1rvyn/halloween-story-generator/pipeline"
+	"github.com/gofiber/fiber/v2"
+)
+
+// imageEdit is the optional body of a regenerate-image request
+type imageEdit struct {
+	ImagePrompt    *string `json:"image_prompt"`
+	NegativePrompt *string `json:"negative_prompt"`
+}
+
+// RegenerateSegmentImage handles POST /api/story/:id/segments/:n/regenerate-image.
+// The segment gets a new image, drawn from a new seed and optionally a new
+// prompt, and the video is rebuilt around it.
+func RegenerateSegmentImage(c *fiber.Ctx) error {
+	story, segment, err := findRedoSegment(c)
+	if err != nil {
+		return err
+	}
+
+	var edit imageEdit
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&edit); err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, "Cannot parse JSON")
+		}
+	}
+	return redo(c, story, pipeline.RedoImage, func() error {
+		return pipeline.RedoImageWithPrompts(story, segment.Number, edit.ImagePrompt, edit.NegativePrompt)
+	})
+}
+
+// RegenerateSegmentAudio handles POST /api/story/:id/segments/:n/regenerate-audio.
+// The segment is narrated again and the video rebuilt around it.
+func RegenerateSegmentAudio(c *fiber.Ctx) error {
+	story, segment, err := findRedoSegment(c)
+	if err != nil {
+		return err
+	}
+	return redo(c, story, pipeline.RedoAudio, func() error {
+		return pipeline.Redo(story, pipeline.RedoAudio, segment.Number)
+	})
+}
+
+// RerenderStory handles POST /api/story/:id/rerender. Every clip is rendered
+// again from the stored images and narration, picking up changes to the
+// story's settings, and the video rebuilt.
+func RerenderStory(c *fiber.Ctx) error {
+	story, err := findUserStory(c)
+	if err != nil {
+		return err
+	}
+	return redo(c, story, pipeline.RedoClips, func() error {
+		return pipeline.Redo(story, pipeline.RedoClips)
+	})
+}
+
+func findRedoSegment(c *fiber.Ctx) (*models.Story, *models.Segment, error) {
+	story, err := findUserStory(c)
+	if err != nil {
+		return nil, nil, err
+	}
+	segment, err := findStorySegment(c, story)
+	if err != nil {
+		return nil, nil, err
+	}
+	return story, segment, nil
+}
+
+// redo clears the assets with start, a pipeline redo, and queues the story,
+// responding like CreateStory along with the story's new version
+func redo(c *fiber.Ctx, story *models.Story, what string, start func() error) error {
+	if err := start(); err != nil {
+		if errors.Is(err, pipeline.ErrStoryBusy) {
+			return fiber.NewError(fiber.StatusConflict, "Story is still being made, try again once it is done")
+		}
+		log.Printf("Error redoing %s for story %d: %v", what, story.ID, err)
+		return fiber.NewError(fiber.StatusInternalServerError, "Internal Server Error")
+	}
+
+	if err := pipeline.Enqueue(story.ID); err != nil {
+		log.Printf("Error queueing story %d: %v", story.ID, err)
+		database.DB.Model(story).Updates(map[string]interface{}{
+			"status": models.StatusFailed,
+			"error":  err.Error(),
+		})
+		return fiber.NewError(fiber.StatusServiceUnavailable, "Too many stories in progress, try again shortly")
+	}
+
+	return c.Status(fiber.StatusAccepted).JSON(fiber.Map{
+		"id":      story.ID,
+		"status":  models.StatusQueued,
+		"version": story.Version,
+	})
+}
@@ -1,166 +1,18 @@
 package routes
 
 import (
-	"bytes"
-	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
-	"io"
 	"log"
-	"net/http"
-	"os"
-	"regexp"
-	"strconv"
-	"strings"
-	"sync"
-	"time"
 
 	"github.com/1rvyn/halloween-story-generator/database"
-	"github.com/1rvyn/halloween-story-generator/middleware"
 	"github.com/1rvyn/halloween-story-generator/misc"
 	"github.com/1rvyn/halloween-story-generator/models"
-	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/service/s3"
-
+	"github.com/1rvyn/halloween-story-generator/pipeline"
 	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
 )
 
-type Message struct {
-	Role    string `json:"role"`
-	Content string `json:"content"`
-}
-
-type Choice struct {
-	Index   int     `json:"index"`
-	Message Message `json:"message"`
-}
-
-type GroqAPIResponse struct {
-	ID      string   `json:"id"`
-	Object  string   `json:"object"`
-	Created int64    `json:"created"`
-	Model   string   `json:"model"`
-	Choices []Choice `json:"choices"`
-}
-
-var replicateResp struct {
-	Output []string `json:"output"`
-	Error  string   `json:"error"`
-	Status string   `json:"status"`
-	URLs   struct {
-		Get string `json:"get"`
-	} `json:"urls"`
-}
-
-func groqReuest(story models.Story) (string, error) {
-	groqReq := models.GroqRequest{
-		Messages: []models.Message{
-			{Role: "system", Content: models.StorySegmentationInstance.Prompt},
-			{Role: "user", Content: story.Content},
-		},
-		Model:       "llama-3.1-70b-versatile",
-		Temperature: 1,
-		MaxTokens:   1024,
-		TopP:        1,
-		Stream:      false, // Changed from true to false
-		Stop:        nil,
-	}
-
-	reqBody, err := json.Marshal(groqReq)
-	if err != nil {
-		log.Printf("Error marshalling request: %v", err)
-		return "", err
-	}
-
-	req, err := http.NewRequest("POST",
-		"https://api.groq.com/openai/v1/chat/completions",
-		bytes.NewBuffer(reqBody))
-	if err != nil {
-		log.Printf("Error creating request: %v", err)
-		return "", err
-	}
-
-	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", os.Getenv("GROQ_API_KEY")))
-	req.Header.Set("Content-Type", "application/json")
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		log.Printf("Error making request: %v", err)
-		return "", err
-	}
-	defer resp.Body.Close()
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		log.Printf("Error reading response body: %v", err)
-		return "", err
-	}
-
-	log.Printf("Groq Response body: \n%s\n", body)
-
-	var apiResp GroqAPIResponse
-	if err := json.Unmarshal(body, &apiResp); err != nil {
-		log.Printf("Error unmarshalling Groq API response: %v", err)
-		return "", err
-	}
-
-	if len(apiResp.Choices) == 0 {
-		log.Printf("No choices found in Groq response")
-		return "", err
-	}
-
-	// Extract the content which contains the XML segments
-	xmlContent := apiResp.Choices[0].Message.Content
-	return xmlContent, nil
-}
-
-func cleanAndSegmentXML(xmlContent string, storyID int) ([]models.Segment, error) {
-	segmentRegex := regexp.MustCompile(`<segment number="(\d+)">\s*([\s\S]*?)\s*</segment>`)
-	matches := segmentRegex.FindAllStringSubmatch(xmlContent, -1)
-	if matches == nil {
-		log.Printf("No segments found in Groq response")
-		return nil, errors.New("no segments found in Groq response")
-	}
-
-	segments := []models.Segment{}
-
-	for _, match := range matches {
-		if len(match) < 3 {
-			log.Printf("Unexpected match format: %v", match)
-			continue
-		}
-		segNumberStr := match[1]
-		segNumber, err := strconv.Atoi(segNumberStr)
-		if err != nil {
-			log.Printf("Invalid segment number: %v", err)
-			continue
-		}
-		segContent := match[2]
-		segmentContent := strings.TrimSpace(segContent)
-		if segmentContent == "" {
-			continue
-		}
-
-		// Create Segment record
-		segment := models.Segment{
-			StoryID: storyID,
-			Segment: segmentContent,
-			Number:  segNumber,
-		}
-
-		if err := database.DB.Create(&segment).Error; err != nil {
-			log.Printf("Error creating segment: %v", err)
-			continue
-		}
-
-		segments = append(segments, segment)
-	}
-
-	return segments, nil
-}
-
 func CreateStory(c *fiber.Ctx) error {
 	story := new(models.Story)
 	if err := c.BodyParser(story); err != nil {
@@ -178,276 +30,120 @@ func CreateStory(c *fiber.Ctx) error {
 		})
 	}
 	story.CreatedBy = int(userID)
-
-	database.DB.Create(story).Scan(&story)
-	fmt.Printf("Just created story ID: %d\n", story.ID)
-
-	// created story
-	xmlContent, err := groqReuest(*story)
-	if err != nil {
-		log.Printf("Error in groq request: %v", err)
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Internal Server Error",
-		})
+	story.Status = models.StatusQueued
+	if story.Title == "" {
+		story.Title = misc.DefaultTitle(story.Content)
 	}
-	// cleanup xml to segment
-	segments, err := cleanAndSegmentXML(xmlContent, int(story.ID))
-	if err != nil {
-		log.Printf("Error in cleanAndSegmentXML: %v", err)
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Internal Server Error",
+
+	if err := pipeline.ValidateSettings(story); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
 		})
 	}
 
-	err = replicateRequests(segments, int(story.ID))
-	if err != nil {
-		log.Printf("Error processing segments: %v", err)
+	if err := database.DB.Create(story).Error; err != nil {
+		log.Printf("Error creating story: %v", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Internal Server Error",
 		})
 	}
+	fmt.Printf("Just created story ID: %d\n", story.ID)
+
+	// The pipeline runs in the background; clients poll the status endpoint
+	return enqueueStory(c, story)
+}
 
-	// Generate video using the segments
-	videoFilePath, err := misc.GenerateFfmpegInputFile(int(story.ID), segments)
+// GetStoryStatus handles GET /api/story/:id/status
+func GetStoryStatus(c *fiber.Ctx) error {
+	story, err := findUserStory(c)
 	if err != nil {
-		log.Printf("Error generating video: %v", err)
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Video creation failed",
-		})
+		return err
 	}
+	signStoryURLs(c, story)
+
+	return c.JSON(fiber.Map{
+		"id":       story.ID,
+		"status":   story.Status,
+		"error":    story.Error,
+		"videoURL": story.VideoURL,
+		"hlsURL":   story.HLSURL,
+		"version":  story.Version,
+	})
+}
 
-	// Upload video to R2
-	now := time.Now()
-	videoFile, err := os.Open(videoFilePath)
-	elapsed := time.Since(now)
+// ResumeStory handles POST /api/story/:id/resume, re-queueing a failed story.
+// The pipeline skips any segment work that was already stored.
+func ResumeStory(c *fiber.Ctx) error {
+	story, err := findUserStory(c)
 	if err != nil {
-		log.Printf("Error opening video file (took %v): %v", elapsed, err)
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to open video file",
-		})
+		return err
 	}
-	defer videoFile.Close()
-	log.Printf("Opening video file took: %v", elapsed)
 
-	if middleware.R2Client == nil {
-		log.Printf("R2 client is not initialized")
+	// Claim the story in one step, so two resumes can't both queue it
+	result := database.DB.Model(&models.Story{}).
+		Where("id = ? AND status = ?", story.ID, models.StatusFailed).
+		Updates(map[string]interface{}{
+			"status": models.StatusQueued,
+			"error":  "",
+		})
+	if result.Error != nil {
+		log.Printf("Error re-queueing story %d: %v", story.ID, result.Error)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Internal Server Error",
 		})
 	}
-
-	objectKey := fmt.Sprintf("videos/story_%d_video.mp4", story.ID)
-	_, err = middleware.R2Client.PutObject(context.TODO(), &s3.PutObjectInput{
-		Bucket:      aws.String("halloween"),
-		Key:         aws.String(objectKey),
-		Body:        videoFile,
-		ContentType: aws.String("video/mp4"),
-	})
-	if err != nil {
-		log.Printf("Error uploading video to R2: %v", err)
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to upload video",
+	if result.RowsAffected == 0 {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "Only failed stories can be resumed",
 		})
 	}
 
-	r2VideoURL := fmt.Sprintf("%s/%s", os.Getenv("R2_S3_API"), objectKey)
+	return enqueueStory(c, story)
+}
 
-	// Update the story with the video URL
-	if err := database.DB.Model(&models.Story{}).Where("id = ?", story.ID).Update("video_url", r2VideoURL).Error; err != nil {
-		log.Printf("Error updating story with VideoURL: %v", err)
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to update story with video URL",
+// enqueueStory hands a queued story to the worker pool and responds with its ID
+func enqueueStory(c *fiber.Ctx, story *models.Story) error {
+	if err := pipeline.Enqueue(story.ID); err != nil {
+		log.Printf("Error queueing story %d: %v", story.ID, err)
+		database.DB.Model(story).Updates(map[string]interface{}{
+			"status": models.StatusFailed,
+			"error":  err.Error(),
+		})
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+			"error": "Too many stories in progress, try again shortly",
 		})
 	}
 
-	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
-		"videoURL": r2VideoURL,
+	return c.Status(fiber.StatusAccepted).JSON(fiber.Map{
+		"id":     story.ID,
+		"status": models.StatusQueued,
 	})
 }
 
-func replicateRequests(segments []models.Segment, storyID int) error {
-	var wg sync.WaitGroup
-	var mutex sync.Mutex
-	errChan := make(chan error, len(segments))
-
-	for i := range segments {
-		wg.Add(1)
-		go func(seg *models.Segment) {
-			defer wg.Done()
-			log.Printf("Starting processing for segment %d", seg.Number)
-			// Prepare the payload for Replicate API
-			replicatePayload := map[string]interface{}{
-				"input": map[string]interface{}{
-					"prompt":         seg.Segment,
-					"num_outputs":    1,
-					"aspect_ratio":   "16:9",
-					"output_format":  "webp",
-					"output_quality": 20,
-				},
-			}
-
-			replicateBody, err := json.Marshal(replicatePayload)
-			if err != nil {
-				errChan <- fmt.Errorf("marshalling Replicate request: %w", err)
-				return
-			}
-
-			req, err := http.NewRequest("POST", "https://api.replicate.com/v1/models/black-forest-labs/flux-schnell/predictions", bytes.NewBuffer(replicateBody))
-			if err != nil {
-				errChan <- fmt.Errorf("creating Replicate request: %w", err)
-				return
-			}
-
-			req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", os.Getenv("REPLICATE_API_TOKEN")))
-			req.Header.Set("Content-Type", "application/json")
-
-			client := &http.Client{}
-			resp, err := client.Do(req)
-			if err != nil {
-				errChan <- fmt.Errorf("making Replicate request: %w", err)
-				return
-			}
-			defer resp.Body.Close()
-
-			if resp.StatusCode != http.StatusCreated {
-				bodyBytes, _ := io.ReadAll(resp.Body)
-				errChan <- fmt.Errorf("replicate API error: %s", string(bodyBytes))
-				return
-			}
-
-			replicateRespBody, err := io.ReadAll(resp.Body)
-			if err != nil {
-				errChan <- fmt.Errorf("reading Replicate response: %w", err)
-				return
-			}
-
-			var pollResp struct {
-				Output []string `json:"output"`
-				Error  string   `json:"error"`
-				Status string   `json:"status"`
-				URLs   struct { // Correctly nested URLs object
-					Get string `json:"get"`
-				} `json:"urls"`
-			}
-			if err := json.Unmarshal(replicateRespBody, &pollResp); err != nil {
-				errChan <- fmt.Errorf("unmarshalling Replicate response: %w", err)
-				return
-			}
-
-			// Use the URL from the initial response for polling
-			pollingURL := pollResp.URLs.Get
-			if pollingURL == "" {
-				errChan <- fmt.Errorf("no polling URL provided in the initial response")
-				return
-			}
-
-			// Polling until the prediction is succeeded or failed
-			for pollResp.Status != "succeeded" && pollResp.Status != "failed" {
-				time.Sleep(1 * time.Second)
-
-				getReq, err := http.NewRequest("GET", pollingURL, nil)
-				if err != nil {
-					errChan <- fmt.Errorf("creating poll request: %w", err)
-					return
-				}
-
-				getReq.Header.Set("Authorization", fmt.Sprintf("Bearer %s", os.Getenv("REPLICATE_API_TOKEN")))
-				getReq.Header.Set("Content-Type", "application/json")
-
-				getResp, err := client.Do(getReq)
-				if err != nil {
-					errChan <- fmt.Errorf("polling Replicate URL: %w", err)
-					return
-				}
-
-				getBody, err := io.ReadAll(getResp.Body)
-				getResp.Body.Close()
-				if err != nil {
-					errChan <- fmt.Errorf("reading poll response: %w", err)
-					return
-				}
-
-				if err := json.Unmarshal(getBody, &pollResp); err != nil {
-					errChan <- fmt.Errorf("unmarshalling poll response: %w", err)
-					return
-				}
-
-				log.Printf("Polling for segment %d: Status=%s", seg.Number, pollResp.Status)
-			}
-
-			if pollResp.Status != "succeeded" {
-				errChan <- fmt.Errorf("replicate API failed for segment %d: %s", seg.Number, pollResp.Error)
-				return
-			}
-
-			if len(pollResp.Output) == 0 {
-				errChan <- fmt.Errorf("no output from Replicate for segment %d", seg.Number)
-				return
-			}
-
-			imageURL := pollResp.Output[0]
-
-			// Download the image from Replicate
-			imageResp, err := http.Get(imageURL)
-			if err != nil {
-				errChan <- fmt.Errorf("downloading image for segment %d: %w", seg.Number, err)
-				return
-			}
-			defer imageResp.Body.Close()
-
-			imageData, err := io.ReadAll(imageResp.Body)
-			if err != nil {
-				errChan <- fmt.Errorf("reading image data for segment %d: %w", seg.Number, err)
-				return
-			}
-
-			// Upload the image to R2
-			objectKey := fmt.Sprintf("images/story_%d_segment_%d.webp", storyID, seg.Number)
-			_, err = middleware.R2Client.PutObject(context.TODO(), &s3.PutObjectInput{
-				Bucket:      aws.String("halloween"),
-				Key:         aws.String(objectKey),
-				Body:        bytes.NewReader(imageData),
-				ContentType: aws.String("image/webp"),
-			})
-			if err != nil {
-				errChan <- fmt.Errorf("uploading to R2 for segment %d: %w", seg.Number, err)
-				return
-			}
-
-			r2ImageURL := fmt.Sprintf("%s/%s", os.Getenv("R2_S3_API"), objectKey)
-
-			// Update the segment with the R2 Image URL
-			mutex.Lock()
-			seg.ImageURL = r2ImageURL
-			if err := database.DB.Save(seg).Error; err != nil {
-				mutex.Unlock()
-				errChan <- fmt.Errorf("updating segment %d with ImageURL: %w", seg.Number, err)
-				return
-			}
-			mutex.Unlock()
-
-			// Store image data in memory for ffmpeg processing
-			mutex.Lock()
-			seg.ImageData = imageData
-			mutex.Unlock()
-
-		}(&segments[i])
+// findUserStory loads the story named by the :id route parameter, provided it
+// belongs to the authenticated user. On failure the returned error is a
+// *fiber.Error that can be passed straight back to Fiber.
+func findUserStory(c *fiber.Ctx) (*models.Story, error) {
+	userID, ok := c.Locals("user_id").(uint)
+	if !ok {
+		return nil, fiber.NewError(fiber.StatusUnauthorized, "Unauthorized")
 	}
 
-	wg.Wait()
-	close(errChan)
-
-	// Collect errors
-	var combinedErr error
-	for err := range errChan {
-		if combinedErr == nil {
-			combinedErr = err
-		} else {
-			combinedErr = fmt.Errorf("%v; %w", combinedErr, err)
-		}
+	storyID, err := c.ParamsInt("id")
+	if err != nil || storyID <= 0 {
+		return nil, fiber.NewError(fiber.StatusBadRequest, "Invalid story ID")
 	}
 
-	return combinedErr
+	var story models.Story
+	err = database.DB.Where("id = ? AND created_by = ?", storyID, userID).First(&story).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, fiber.NewError(fiber.StatusNotFound, "Story not found")
+	}
+	if err != nil {
+		log.Printf("Error fetching story %d: %v", storyID, err)
+		return nil, fiber.NewError(fiber.StatusInternalServerError, "Internal Server Error")
+	}
+	return &story, nil
 }
 
 func GetStories(c *fiber.Ctx) error {
@@ -469,6 +165,10 @@ func GetStories(c *fiber.Ctx) error {
 		})
 	}
 
+	for i := range stories {
+		signStoryURLs(c, &stories[i])
+	}
+
 	log.Printf("Fetched %d stories for user ID %d", len(stories), userID)
 	return c.JSON(stories)
 }
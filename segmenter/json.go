@@ -0,0 +1,113 @@
+package segmenter
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/1rvyn/halloween-story-generator/misc"
+	"github.com/1rvyn/halloween-story-generator/models"
+)
+
+// Response formats the chat segmenters can ask for
+const (
+	FormatXML  = "xml"  // <segment> tags, which any model can manage
+	FormatJSON = "json" // JSON against segmentationSchema, for providers with structured output
+)
+
+// segmentationSchema describes models.SegmentationJSON. Strict structured
+// output needs every property required and no others allowed.
+var segmentationSchema = map[string]interface{}{
+	"type":                 "object",
+	"additionalProperties": false,
+	"required":             []string{"segments"},
+	"properties": map[string]interface{}{
+		"segments": map[string]interface{}{
+			"type": "array",
+			"items": map[string]interface{}{
+				"type":                 "object",
+				"additionalProperties": false,
+				"required":             []string{"number", "text", "image_prompt", "mood", "characters", "camera_motion"},
+				"properties": map[string]interface{}{
+					"number":       map[string]interface{}{"type": "integer"},
+					"text":         map[string]interface{}{"type": "string"},
+					"image_prompt": map[string]interface{}{"type": "string"},
+					"mood":         map[string]interface{}{"type": "string"},
+					"characters":   map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "string"}},
+					"camera_motion": map[string]interface{}{
+						"type": "string",
+						"enum": misc.MotionPresets(),
+					},
+				},
+			},
+		},
+	},
+}
+
+// segmentationResponseFormat is the response_format asking for JSON against the schema
+var segmentationResponseFormat = map[string]interface{}{
+	"type": "json_schema",
+	"json_schema": map[string]interface{}{
+		"name":   "story_segmentation",
+		"strict": true,
+		"schema": segmentationSchema,
+	},
+}
+
+// parseJSONSegments decodes a JSON mode response and checks it against the
+// story the same way parseSegments does. Anything around the outermost
+// object is ignored, such as code fences from providers that ignore the
+// response format.
+func parseJSONSegments(content, story string) ([]Segment, error) {
+	perr := &ParseError{}
+
+	start, end := strings.Index(content, "{"), strings.LastIndex(content, "}")
+	if start < 0 || end < start {
+		perr.add(ProblemMalformed, 0, "the response has no JSON object")
+		return nil, perr
+	}
+	var response models.SegmentationJSON
+	if err := json.Unmarshal([]byte(content[start:end+1]), &response); err != nil {
+		perr.add(ProblemMalformed, 0, "the response could not be read as JSON: %v", err)
+		return nil, perr
+	}
+	if len(response.Segments) == 0 {
+		perr.add(ProblemNoSegment, 0, "the response has no segments")
+		return nil, perr
+	}
+
+	segments := make([]Segment, 0, len(response.Segments))
+	for i, raw := range response.Segments {
+		number := raw.Number
+		if number <= 0 {
+			perr.add(ProblemNumber, i+1, "segment %d has number %d, expected a positive integer", i+1, raw.Number)
+			number = i + 1
+		}
+
+		// Motion is only a suggestion, so one the renderer doesn't know is dropped
+		motion := strings.ToLower(strings.TrimSpace(raw.CameraMotion))
+		if motion == misc.MotionAuto || misc.ValidateMotion(motion) != nil {
+			motion = ""
+		}
+		var characters []string
+		for _, character := range raw.Characters {
+			if character = strings.TrimSpace(character); character != "" {
+				characters = append(characters, character)
+			}
+		}
+
+		segments = append(segments, Segment{
+			Number:       number,
+			Text:         strings.Join(strings.Fields(raw.Text), " "),
+			ImagePrompt:  strings.TrimSpace(raw.ImagePrompt),
+			Mood:         strings.ToLower(strings.TrimSpace(raw.Mood)),
+			Characters:   characters,
+			CameraMotion: motion,
+		})
+	}
+
+	validateSegments(segments, story, perr)
+	if len(perr.Problems) > 0 {
+		return nil, perr
+	}
+	return segments, nil
+}
@@ -0,0 +1,173 @@
+package segmenter
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/1rvyn/halloween-story-generator/models"
+)
+
+const groqBaseURL = "https://api.groq.com/openai/v1"
+
+type choice struct {
+	Index   int            `json:"index"`
+	Message models.Message `json:"message"`
+}
+
+type chatResponse struct {
+	ID      string   `json:"id"`
+	Object  string   `json:"object"`
+	Created int64    `json:"created"`
+	Model   string   `json:"model"`
+	Choices []choice `json:"choices"`
+}
+
+// OpenAICompatible segments stories with any chat completions API that
+// follows OpenAI's request format, e.g. Groq, OpenAI, vLLM or Ollama.
+type OpenAICompatible struct {
+	BaseURL     string // e.g. https://api.openai.com/v1, without the trailing /chat/completions
+	APIKey      string
+	Model       string
+	Temperature float64
+	MaxTokens   int
+	TopP        float64
+	MaxAttempts int    // Requests per story, retrying when the segmentation doesn't validate
+	Format      string // FormatXML (default) or FormatJSON
+	Client      *http.Client
+}
+
+// NewOpenAICompatible returns a segmenter for the chat API at baseURL
+func NewOpenAICompatible(baseURL, apiKey, model string) *OpenAICompatible {
+	return &OpenAICompatible{
+		BaseURL:     strings.TrimSuffix(baseURL, "/"),
+		APIKey:      apiKey,
+		Model:       model,
+		Temperature: 1,
+		MaxTokens:   4096, // Room for the whole story, which the segments must repeat
+		TopP:        1,
+		MaxAttempts: 3,
+		Client:      &http.Client{},
+	}
+}
+
+// NewGroq returns a segmenter for Groq's hosted Llama
+func NewGroq(apiKey string) *OpenAICompatible {
+	return NewOpenAICompatible(groqBaseURL, apiKey, "llama-3.1-70b-versatile")
+}
+
+// Segment asks the model to segment the story. When the response doesn't
+// validate, the model is shown what was wrong and asked again.
+func (o *OpenAICompatible) Segment(ctx context.Context, story string) ([]Segment, error) {
+	prompt, parse := models.StorySegmentationInstance.Prompt, parseSegments
+	var responseFormat interface{}
+	if o.Format == FormatJSON {
+		prompt, parse = models.StorySegmentationJSONInstance.Prompt, parseJSONSegments
+		responseFormat = segmentationResponseFormat
+	}
+	messages := []models.Message{
+		{Role: "system", Content: prompt},
+		{Role: "user", Content: story},
+	}
+
+	var lastErr error
+	for attempt := 1; attempt <= o.MaxAttempts || attempt == 1; attempt++ {
+		content, err := o.complete(ctx, messages, responseFormat)
+		if err != nil {
+			return nil, err
+		}
+
+		segments, err := parse(content, story)
+		var perr *ParseError
+		if !errors.As(err, &perr) {
+			return segments, err
+		}
+		log.Printf("Segmentation attempt %d rejected: %v", attempt, err)
+		lastErr = err
+
+		messages = append(messages,
+			models.Message{Role: "assistant", Content: content},
+			models.Message{Role: "user", Content: o.retryPrompt(perr)},
+		)
+	}
+	return nil, lastErr
+}
+
+// retryPrompt asks the model to fix the problems with its last answer
+func (o *OpenAICompatible) retryPrompt(perr *ParseError) string {
+	var b strings.Builder
+	b.WriteString("Your segmentation can't be used:\n")
+	for _, p := range perr.Problems {
+		fmt.Fprintf(&b, "- %s\n", p.Detail)
+	}
+	if o.Format == FormatJSON {
+		b.WriteString("Segment the whole story again, keeping every sentence, and reply with only the JSON object.")
+	} else {
+		b.WriteString("Segment the whole story again, keeping every sentence, and reply with only the numbered <segment> tags.")
+	}
+	return b.String()
+}
+
+// complete sends a chat completion request and returns the first choice's
+// content. responseFormat is nil for plain text.
+func (o *OpenAICompatible) complete(ctx context.Context, messages []models.Message, responseFormat interface{}) (string, error) {
+	chatReq := models.GroqRequest{
+		Messages:       messages,
+		Model:          o.Model,
+		Temperature:    o.Temperature,
+		MaxTokens:      o.MaxTokens,
+		TopP:           o.TopP,
+		Stream:         false,
+		Stop:           nil,
+		ResponseFormat: responseFormat,
+	}
+
+	reqBody, err := json.Marshal(chatReq)
+	if err != nil {
+		return "", fmt.Errorf("marshalling chat request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", o.BaseURL+"/chat/completions", bytes.NewBuffer(reqBody))
+	if err != nil {
+		return "", fmt.Errorf("creating chat request: %w", err)
+	}
+
+	if o.APIKey != "" {
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", o.APIKey))
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := o.Client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("making chat request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("reading chat response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("chat API request failed with status %d: %s", resp.StatusCode, string(body))
+	}
+
+	log.Printf("Chat response body: \n%s\n", body)
+
+	var apiResp chatResponse
+	if err := json.Unmarshal(body, &apiResp); err != nil {
+		return "", fmt.Errorf("unmarshalling chat response: %w", err)
+	}
+
+	if len(apiResp.Choices) == 0 {
+		return "", errors.New("no choices found in chat response")
+	}
+
+	return apiResp.Choices[0].Message.Content, nil
+}
@@ -0,0 +1,187 @@
+package segmenter
+
+import (
+	"encoding/xml"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/1rvyn/halloween-story-generator/models"
+)
+
+// MaxSegmentChars is the longest segment narrated over one image
+const MaxSegmentChars = 1000
+
+const minCoverage = 0.9 // Share of the story's words the segments must keep
+
+// ProblemKind says what is wrong with a model's segmentation
+type ProblemKind string
+
+const (
+	ProblemMalformed ProblemKind = "malformed" // The response isn't usable XML
+	ProblemTruncated ProblemKind = "truncated" // The response stops partway through a segment
+	ProblemNoSegment ProblemKind = "no_segments"
+	ProblemNumber    ProblemKind = "bad_number" // A number attribute that isn't a positive integer
+	ProblemDuplicate ProblemKind = "duplicate"
+	ProblemMissing   ProblemKind = "missing" // A gap in the numbering
+	ProblemOrder     ProblemKind = "out_of_order"
+	ProblemEmpty     ProblemKind = "empty"
+	ProblemTooLong   ProblemKind = "too_long"
+	ProblemCoverage  ProblemKind = "coverage" // The segments leave out part of the story
+)
+
+// Problem is one thing wrong with a model's segmentation
+type Problem struct {
+	Kind    ProblemKind
+	Segment int // The segment's number, or 0 if the problem isn't with one segment
+	Detail  string
+}
+
+// ParseError reports why a model's segmentation can't be used. Its message
+// lists every problem, so it can be sent back to the model to fix.
+type ParseError struct {
+	Problems []Problem
+}
+
+func (e *ParseError) Error() string {
+	details := make([]string, len(e.Problems))
+	for i, p := range e.Problems {
+		details[i] = p.Detail
+	}
+	return "invalid segmentation: " + strings.Join(details, "; ")
+}
+
+func (e *ParseError) add(kind ProblemKind, segment int, format string, args ...interface{}) {
+	e.Problems = append(e.Problems, Problem{Kind: kind, Segment: segment, Detail: fmt.Sprintf(format, args...)})
+}
+
+// parseSegments decodes the <segment> tags of an LLM response and checks
+// them against the story. Anything around the segments is ignored, such as
+// code fences, prose, or a missing root element.
+func parseSegments(content, story string) ([]Segment, error) {
+	perr := &ParseError{}
+
+	var response models.GroqResponse
+	decoder := xml.NewDecoder(strings.NewReader(segmentDocument(content)))
+	decoder.Strict = false // Allow unquoted attributes and stray ampersands
+	decoder.Entity = xml.HTMLEntity
+	if err := decoder.Decode(&response); err != nil {
+		perr.add(ProblemMalformed, 0, "the response could not be read as <segment> tags: %v", err)
+		return nil, perr
+	}
+	if len(response.Segments) == 0 {
+		perr.add(ProblemNoSegment, 0, "the response has no <segment> tags")
+		return nil, perr
+	}
+
+	// The decoder closes an unfinished last segment, so check for one first
+	if strings.LastIndex(content, "<segment") > strings.LastIndex(content, "</segment>") {
+		perr.add(ProblemTruncated, len(response.Segments), "the response stops partway through segment %d", len(response.Segments))
+		return nil, perr
+	}
+
+	segments := make([]Segment, 0, len(response.Segments))
+	for i, raw := range response.Segments {
+		number, err := strconv.Atoi(strings.TrimSpace(raw.Number))
+		if err != nil || number <= 0 {
+			perr.add(ProblemNumber, i+1, "segment %d has number %q, expected a positive integer", i+1, raw.Number)
+			number = i + 1
+		}
+		segments = append(segments, Segment{
+			Number: number,
+			Text:   strings.Join(strings.Fields(raw.Content), " "),
+		})
+	}
+
+	validateSegments(segments, story, perr)
+	if len(perr.Problems) > 0 {
+		return nil, perr
+	}
+	return segments, nil
+}
+
+// segmentDocument cuts the segments out of a response and wraps them in the
+// <response> root that models.GroqResponse decodes
+func segmentDocument(content string) string {
+	start := strings.Index(content, "<segment")
+	if start < 0 {
+		return "<response></response>"
+	}
+	content = content[start:]
+	if end := strings.LastIndex(content, "</segment>"); end >= 0 {
+		content = content[:end+len("</segment>")]
+	}
+	return "<response>" + content + "</response>"
+}
+
+// validateSegments checks the numbering runs 1, 2, 3... in order, that every
+// segment has text of a length that can be narrated over one image, and that
+// together the segments tell the whole story
+func validateSegments(segments []Segment, story string, perr *ParseError) {
+	seen := make(map[int]bool, len(segments))
+	highest := 0
+	for _, seg := range segments {
+		if seen[seg.Number] {
+			perr.add(ProblemDuplicate, seg.Number, "segment number %d is used more than once", seg.Number)
+		}
+		seen[seg.Number] = true
+		if seg.Number > highest {
+			highest = seg.Number
+		}
+
+		if seg.Text == "" {
+			perr.add(ProblemEmpty, seg.Number, "segment %d has no text", seg.Number)
+		} else if len(seg.Text) > MaxSegmentChars {
+			perr.add(ProblemTooLong, seg.Number, "segment %d is %d characters long, the limit is %d", seg.Number, len(seg.Text), MaxSegmentChars)
+		}
+	}
+	for n := 1; n <= highest; n++ {
+		if !seen[n] {
+			perr.add(ProblemMissing, n, "segment %d is missing", n)
+		}
+	}
+	if len(perr.Problems) == 0 {
+		for i, seg := range segments {
+			if seg.Number != i+1 {
+				perr.add(ProblemOrder, seg.Number, "segment %d is out of order, segments must be numbered in the order they appear", seg.Number)
+				break
+			}
+		}
+	}
+
+	if coverage := storyCoverage(segments, story); coverage < minCoverage {
+		perr.add(ProblemCoverage, 0, "the segments keep only %.0f%% of the story's words, every sentence of the story must be in a segment", math.Floor(coverage*100))
+	}
+}
+
+// storyCoverage is the share of the story's words that appear in the
+// segments, ignoring case and punctuation
+func storyCoverage(segments []Segment, story string) float64 {
+	remaining := make(map[string]int)
+	for _, seg := range segments {
+		for _, word := range normalizedWords(seg.Text) {
+			remaining[word]++
+		}
+	}
+
+	storyWords := normalizedWords(story)
+	if len(storyWords) == 0 {
+		return 1
+	}
+	covered := 0
+	for _, word := range storyWords {
+		if remaining[word] > 0 {
+			remaining[word]--
+			covered++
+		}
+	}
+	return float64(covered) / float64(len(storyWords))
+}
+
+func normalizedWords(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
@@ -0,0 +1,219 @@
+package segmenter
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/1rvyn/halloween-story-generator/models"
+)
+
+const parseStory = "The door creaked open. Tom & Ana froze.\n\nSomething breathed in the dark."
+
+func TestParseSegmentsLooseOutput(t *testing.T) {
+	content := "Here are the segments:\n```xml\n" +
+		"<segment number=1>\nThe door creaked open. Tom &amp; Ana froze.\n</segment>\n" +
+		"Some commentary the model added.\n" +
+		"<segment number='2'>Something breathed in the dark.</segment>\n```\nHope this helps!"
+
+	segments, err := parseSegments(content, parseStory)
+	if err != nil {
+		t.Fatalf("Expected success, got error: %v", err)
+	}
+	if len(segments) != 2 || segments[0].Text != "The door creaked open. Tom & Ana froze." || segments[1].Number != 2 {
+		t.Errorf("Unexpected segments: %+v", segments)
+	}
+
+	// A bare ampersand, as models often write, is kept as text
+	segments, err = parseSegments(`<segment number="1">The door creaked open. Tom & Ana froze. Something breathed in the dark.</segment>`, parseStory)
+	if err != nil || !strings.Contains(segments[0].Text, "Tom & Ana") {
+		t.Errorf("Expected the ampersand to survive, got %+v, %v", segments, err)
+	}
+}
+
+func TestParseSegmentsProblems(t *testing.T) {
+	long := strings.Repeat("dark ", MaxSegmentChars/5+1)
+	tests := []struct {
+		name    string
+		content string
+		want    []ProblemKind
+	}{
+		{"no segments", "I can't help with that.", []ProblemKind{ProblemNoSegment}},
+		{"truncated", `<segment number="1">The door creaked open. Tom & Ana froze.`, []ProblemKind{ProblemTruncated}},
+		{"malformed", `<segment number="1"><![CDATA[The door creaked open. Tom & Ana froze. Something breathed in the dark.</segment>`, []ProblemKind{ProblemMalformed}},
+		{"bad number", `<segment number="one">The door creaked open. Tom & Ana froze. Something breathed in the dark.</segment>`, []ProblemKind{ProblemNumber}},
+		{"gap", `<segment number="1">The door creaked open. Tom & Ana froze.</segment><segment number="3">Something breathed in the dark.</segment>`, []ProblemKind{ProblemMissing}},
+		{"duplicate", `<segment number="1">The door creaked open. Tom & Ana froze.</segment><segment number="1">Something breathed in the dark.</segment>`, []ProblemKind{ProblemDuplicate}},
+		{"order", `<segment number="2">The door creaked open. Tom & Ana froze.</segment><segment number="1">Something breathed in the dark.</segment>`, []ProblemKind{ProblemOrder}},
+		{"empty", `<segment number="1">The door creaked open. Tom & Ana froze. Something breathed in the dark.</segment><segment number="2"> </segment>`, []ProblemKind{ProblemEmpty}},
+		{"too long", `<segment number="1">The door creaked open. Tom & Ana froze. Something breathed in the ` + long + `</segment>`, []ProblemKind{ProblemTooLong}},
+		{"coverage", `<segment number="1">The door creaked open.</segment>`, []ProblemKind{ProblemCoverage}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseSegments(tt.content, parseStory)
+			var perr *ParseError
+			if !errors.As(err, &perr) {
+				t.Fatalf("Expected a *ParseError, got %v", err)
+			}
+			var got []ProblemKind
+			for _, p := range perr.Problems {
+				got = append(got, p.Kind)
+			}
+			if len(got) != len(tt.want) || got[0] != tt.want[0] {
+				t.Errorf("Expected problems %v, got %v (%v)", tt.want, got, err)
+			}
+		})
+	}
+}
+
+func TestOpenAICompatibleRetriesInvalidSegmentation(t *testing.T) {
+	responses := []string{
+		`<segment number="1">The door creaked open.</segment>`,
+		`<segment number="1">The door creaked open. Tom & Ana froze.</segment><segment number="2">Something breathed in the dark.</segment>`,
+	}
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req models.GroqRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("Failed to decode request: %v", err)
+		}
+		if requests == 1 {
+			last := req.Messages[len(req.Messages)-1]
+			if len(req.Messages) != 4 || !strings.Contains(last.Content, "keep only") {
+				t.Errorf("Expected the retry to explain the problem, got %+v", req.Messages)
+			}
+		}
+
+		json.NewEncoder(w).Encode(chatResponse{
+			Choices: []choice{{Message: models.Message{Role: "assistant", Content: responses[requests]}}},
+		})
+		requests++
+	}))
+	defer server.Close()
+
+	segments, err := NewOpenAICompatible(server.URL, "", "test-model").Segment(context.Background(), parseStory)
+	if err != nil {
+		t.Fatalf("Expected success, got error: %v", err)
+	}
+	if requests != 2 || len(segments) != 2 {
+		t.Errorf("Expected 2 requests and 2 segments, got %d and %+v", requests, segments)
+	}
+}
+
+func TestParseJSONSegments(t *testing.T) {
+	content := "```json\n" + `{"segments": [
+		{"number": 1, "text": "The door creaked open. Tom & Ana froze.", "image_prompt": "A door ajar in a dark hallway", "mood": "Tense", "characters": ["Tom", " Ana "], "camera_motion": "zoom-in"},
+		{"number": 2, "text": "Something breathed in the dark.", "image_prompt": "Darkness with two faint eyes", "mood": "terrifying", "characters": [], "camera_motion": "spin"}
+	]}` + "\n```"
+
+	segments, err := parseJSONSegments(content, parseStory)
+	if err != nil {
+		t.Fatalf("Expected success, got error: %v", err)
+	}
+	if len(segments) != 2 {
+		t.Fatalf("Expected 2 segments, got %+v", segments)
+	}
+	first := segments[0]
+	if first.Text != "The door creaked open. Tom & Ana froze." || first.ImagePrompt != "A door ajar in a dark hallway" ||
+		first.Mood != "tense" || len(first.Characters) != 2 || first.Characters[1] != "Ana" || first.CameraMotion != "zoom-in" {
+		t.Errorf("Unexpected first segment: %+v", first)
+	}
+	if segments[1].CameraMotion != "" {
+		t.Errorf("Expected an unknown camera motion to be dropped, got %q", segments[1].CameraMotion)
+	}
+
+	_, err = parseJSONSegments(`{"segments": [{"number": 2, "text": "The door creaked open. Tom & Ana froze. Something breathed in the dark."}]}`, parseStory)
+	var perr *ParseError
+	if !errors.As(err, &perr) || perr.Problems[0].Kind != ProblemMissing {
+		t.Errorf("Expected a missing segment problem, got %v", err)
+	}
+}
+
+func TestOpenAICompatibleJSONMode(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Messages       []models.Message `json:"messages"`
+			ResponseFormat struct {
+				Type string `json:"type"`
+			} `json:"response_format"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("Failed to decode request: %v", err)
+		}
+		if req.ResponseFormat.Type != "json_schema" || req.Messages[0].Content != models.StorySegmentationJSONInstance.Prompt {
+			t.Errorf("Expected a JSON schema request, got %+v", req)
+		}
+
+		json.NewEncoder(w).Encode(chatResponse{
+			Choices: []choice{{Message: models.Message{Role: "assistant",
+				Content: `{"segments": [{"number": 1, "text": "The door creaked open. Tom & Ana froze. Something breathed in the dark.", "image_prompt": "A dark hallway", "mood": "eerie", "characters": ["Tom", "Ana"], "camera_motion": "pan-left"}]}`}}},
+		})
+	}))
+	defer server.Close()
+
+	seg := NewOpenAICompatible(server.URL, "", "test-model")
+	seg.Format = FormatJSON
+	segments, err := seg.Segment(context.Background(), parseStory)
+	if err != nil {
+		t.Fatalf("Expected success, got error: %v", err)
+	}
+	if len(segments) != 1 || segments[0].Mood != "eerie" || segments[0].CameraMotion != "pan-left" {
+		t.Errorf("Unexpected segments: %+v", segments)
+	}
+}
+
+func TestOpenAICompatibleVisuals(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req models.GroqRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("Failed to decode request: %v", err)
+		}
+		input := req.Messages[1].Content
+		if !strings.Contains(input, `"scene":"A dark hallway"`) || !strings.Contains(input, `"name":"Ana"`) {
+			t.Errorf("Expected the scene and the bible's characters to be passed on, got %s", input)
+		}
+
+		json.NewEncoder(w).Encode(chatResponse{
+			Choices: []choice{{Message: models.Message{Role: "assistant", Content: `{
+				"art_style": "Woodcut print",
+				"characters": [{"name": "Tom", "description": "a thin man in a grey coat"}, {"name": "ana", "description": "a different description"}],
+				"segments": [
+					{"number": 1, "prompt": "A door ajar at the end of a dark hallway.", "negative_prompt": "daylight", "characters": ["tom", "Ana", "the narrator"]},
+					{"number": 2, "prompt": "Two faint eyes in the blackness", "negative_prompt": "", "characters": []}
+				]}`}}},
+		})
+	}))
+	defer server.Close()
+
+	segments := []Segment{
+		{Number: 1, Text: "The door creaked open. Tom & Ana froze.", ImagePrompt: "A dark hallway"},
+		{Number: 2, Text: "Something breathed in the dark."},
+	}
+	bible := &models.StoryBible{Characters: []models.Character{{Name: "Ana", Description: "a girl in a red scarf", Seed: 7}}}
+	visuals, err := NewOpenAICompatible(server.URL, "", "test-model").Visuals(context.Background(), parseStory, segments, bible)
+	if err != nil {
+		t.Fatalf("Expected success, got error: %v", err)
+	}
+
+	if visuals.ArtStyle != "Woodcut print" || len(visuals.Characters) != 2 || visuals.Characters[0].Description != "a girl in a red scarf" {
+		t.Errorf("Unexpected style and characters: %q, %+v", visuals.ArtStyle, visuals.Characters)
+	}
+	if len(visuals.Prompts) != 2 {
+		t.Fatalf("Expected 2 prompts, got %+v", visuals.Prompts)
+	}
+	first := visuals.Prompts[0]
+	if first.Prompt != "A door ajar at the end of a dark hallway." || first.NegativePrompt != "daylight" ||
+		strings.Join(first.Characters, ",") != "Tom,Ana" {
+		t.Errorf("Unexpected first prompt: %+v", first)
+	}
+
+	if _, err := parseVisuals(`{"segments": [{"number": 1, "prompt": "A hallway"}]}`, segments, nil); err == nil {
+		t.Error("Expected an error for a segment without a prompt, got nil")
+	}
+}
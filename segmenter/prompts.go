@@ -0,0 +1,139 @@
+package segmenter
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/1rvyn/halloween-story-generator/models"
+)
+
+// Visuals is how a story's images should look: an art style, the recurring
+// characters, and what to draw for each segment
+type Visuals struct {
+	ArtStyle   string
+	Characters []models.Character // Without seeds, which the pipeline keeps or assigns
+	Prompts    []ImagePrompt      // One per segment, in order
+}
+
+// ImagePrompt is what to draw for one segment, without the art style or the
+// characters' descriptions, which come from the story's bible
+type ImagePrompt struct {
+	Number         int
+	Prompt         string
+	NegativePrompt string
+	Characters     []string // Names of the recurring characters in the image
+}
+
+// Prompter works out a story's visuals from its segments. Segmenters backed
+// by a language model implement it.
+type Prompter interface {
+	Visuals(ctx context.Context, story string, segments []Segment, bible *models.StoryBible) (*Visuals, error)
+}
+
+// promptSegment is a segment as the image prompt step is given it
+type promptSegment struct {
+	Number     int      `json:"number"`
+	Text       string   `json:"text"`
+	Scene      string   `json:"scene,omitempty"`
+	Characters []string `json:"characters,omitempty"`
+}
+
+// Visuals asks the model for an art style, a description of each recurring
+// character and a visual prompt for every segment. Whatever the bible
+// already settles is passed along for the model to keep.
+func (o *OpenAICompatible) Visuals(ctx context.Context, story string, segments []Segment, bible *models.StoryBible) (*Visuals, error) {
+	input := struct {
+		Story      string                 `json:"story"`
+		ArtStyle   string                 `json:"art_style,omitempty"`
+		Characters []models.CharacterJSON `json:"characters,omitempty"`
+		Segments   []promptSegment        `json:"segments"`
+	}{Story: story}
+	if bible != nil {
+		input.ArtStyle = bible.ArtStyle
+		for _, character := range bible.Characters {
+			input.Characters = append(input.Characters, models.CharacterJSON{Name: character.Name, Description: character.Description})
+		}
+	}
+	for _, seg := range segments {
+		input.Segments = append(input.Segments, promptSegment{
+			Number:     seg.Number,
+			Text:       seg.Text,
+			Scene:      seg.ImagePrompt,
+			Characters: seg.Characters,
+		})
+	}
+	inputJSON, err := json.Marshal(input)
+	if err != nil {
+		return nil, fmt.Errorf("marshalling segments: %w", err)
+	}
+
+	content, err := o.complete(ctx, []models.Message{
+		{Role: "system", Content: models.ImagePromptInstance.Prompt},
+		{Role: "user", Content: string(inputJSON)},
+	}, map[string]string{"type": "json_object"})
+	if err != nil {
+		return nil, err
+	}
+	return parseVisuals(content, segments, bible)
+}
+
+// parseVisuals reads the model's answer, with a prompt for every segment in
+// order. Characters in a prompt must be the bible's or among the new ones,
+// and the bible's descriptions win over the model's.
+func parseVisuals(content string, segments []Segment, given *models.StoryBible) (*Visuals, error) {
+	start, end := strings.Index(content, "{"), strings.LastIndex(content, "}")
+	if start < 0 || end < start {
+		return nil, fmt.Errorf("image prompt response has no JSON object")
+	}
+	var response models.ImagePromptsJSON
+	if err := json.Unmarshal([]byte(content[start:end+1]), &response); err != nil {
+		return nil, fmt.Errorf("unmarshalling image prompts: %w", err)
+	}
+
+	visuals := &Visuals{ArtStyle: strings.TrimSpace(response.ArtStyle)}
+	bible := &models.StoryBible{}
+	if given != nil {
+		bible.Characters = append(bible.Characters, given.Characters...)
+	}
+	for _, raw := range response.Characters {
+		name, description := strings.TrimSpace(raw.Name), strings.TrimSpace(raw.Description)
+		if name == "" || description == "" || bible.Character(name) != nil {
+			continue
+		}
+		bible.Characters = append(bible.Characters, models.Character{Name: name, Description: description})
+	}
+	for _, character := range bible.Characters {
+		visuals.Characters = append(visuals.Characters, models.Character{Name: character.Name, Description: character.Description})
+	}
+
+	byNumber := make(map[int]models.ImagePromptJSON, len(response.Segments))
+	for _, raw := range response.Segments {
+		byNumber[raw.Number] = raw
+	}
+
+	for _, seg := range segments {
+		raw, ok := byNumber[seg.Number]
+		prompt := strings.TrimSpace(raw.Prompt)
+		if !ok || prompt == "" {
+			return nil, fmt.Errorf("no image prompt for segment %d", seg.Number)
+		}
+
+		// Use the bible's spelling of each name
+		var characters []string
+		for _, name := range raw.Characters {
+			if character := bible.Character(name); character != nil {
+				characters = append(characters, character.Name)
+			}
+		}
+
+		visuals.Prompts = append(visuals.Prompts, ImagePrompt{
+			Number:         seg.Number,
+			Prompt:         prompt,
+			NegativePrompt: strings.TrimSpace(raw.NegativePrompt),
+			Characters:     characters,
+		})
+	}
+	return visuals, nil
+}
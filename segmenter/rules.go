@@ -0,0 +1,109 @@
+package segmenter
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+var paragraphBreak = regexp.MustCompile(`\n\s*\n`)
+
+// Titles that end in a full stop without ending the sentence
+var abbreviations = map[string]bool{
+	"mr.": true, "mrs.": true, "ms.": true, "dr.": true, "st.": true, "mt.": true, "jr.": true, "sr.": true,
+}
+
+// RuleBased splits stories without calling out to a model. Paragraphs always
+// start a new segment, and long paragraphs are broken into runs of sentences.
+// It is deterministic, so it is what tests and offline runs use.
+type RuleBased struct {
+	MaxSentences int // Most sentences in one segment
+	MaxChars     int // Soft limit on segment length, a single long sentence can exceed it
+}
+
+// NewRuleBased returns a rule-based segmenter aiming for the same 2-4
+// sentence segments the LLM prompt asks for
+func NewRuleBased() *RuleBased {
+	return &RuleBased{
+		MaxSentences: 3,
+		MaxChars:     400,
+	}
+}
+
+func (r *RuleBased) Segment(ctx context.Context, story string) ([]Segment, error) {
+	var segments []Segment
+
+	for _, paragraph := range paragraphBreak.Split(strings.ReplaceAll(story, "\r\n", "\n"), -1) {
+		var current []string
+		currentLen := 0
+
+		flush := func() {
+			if len(current) == 0 {
+				return
+			}
+			segments = append(segments, Segment{
+				Number: len(segments) + 1,
+				Text:   strings.Join(current, " "),
+			})
+			current = nil
+			currentLen = 0
+		}
+
+		for _, sentence := range splitSentences(paragraph) {
+			if len(current) > 0 && (len(current) >= r.MaxSentences || currentLen+len(sentence) > r.MaxChars) {
+				flush()
+			}
+			current = append(current, sentence)
+			currentLen += len(sentence) + 1
+		}
+		flush()
+	}
+
+	if len(segments) == 0 {
+		return nil, errors.New("story has no text to segment")
+	}
+	return segments, nil
+}
+
+// splitSentences breaks a paragraph into sentences, keeping each sentence's
+// closing punctuation and quotes, and folding line breaks into spaces
+func splitSentences(paragraph string) []string {
+	text := strings.Join(strings.Fields(paragraph), " ")
+	runes := []rune(text)
+
+	var sentences []string
+	start := 0
+	for i := 0; i < len(runes); i++ {
+		if !strings.ContainsRune(".!?…", runes[i]) {
+			continue
+		}
+
+		// Take in any run of terminators and closing quotes or brackets
+		end := i + 1
+		for end < len(runes) && strings.ContainsRune(".!?…\"'”’)]", runes[end]) {
+			end++
+		}
+		if end < len(runes) && !unicode.IsSpace(runes[end]) {
+			continue
+		}
+
+		sentence := strings.TrimSpace(string(runes[start:end]))
+		words := strings.Fields(sentence)
+		if len(words) > 0 && abbreviations[strings.ToLower(words[len(words)-1])] {
+			continue
+		}
+
+		if sentence != "" {
+			sentences = append(sentences, sentence)
+		}
+		start = end
+		i = end - 1
+	}
+
+	if rest := strings.TrimSpace(string(runes[start:])); rest != "" {
+		sentences = append(sentences, rest)
+	}
+	return sentences
+}
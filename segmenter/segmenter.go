@@ -0,0 +1,74 @@
+package segmenter
+
+import (
+	"context"
+	"fmt"
+	"os"
+)
+
+// Segment is one narrated part of a story, paired with a single image in the video
+type Segment struct {
+	Number int
+	Text   string
+
+	// Only JSON mode fills these in
+	ImagePrompt  string
+	Mood         string
+	Characters   []string
+	CameraMotion string
+}
+
+// Segmenter splits a story into the segments the video is built from
+type Segmenter interface {
+	Segment(ctx context.Context, story string) ([]Segment, error)
+}
+
+// Default is the segmenter the pipeline uses, set up by Initialize
+var Default Segmenter
+
+// Initialize picks the segmenter from the SEGMENTER environment variable.
+// It should be called during application startup.
+//
+//	groq   (default) Groq's hosted Llama, needs GROQ_API_KEY
+//	openai any OpenAI-compatible chat API, configured with SEGMENTER_BASE_URL,
+//	       SEGMENTER_API_KEY and SEGMENTER_MODEL
+//	rules  the offline sentence and paragraph splitter
+//
+// SEGMENTER_FORMAT=json has the chat segmenters ask for JSON against a
+// schema, which also gets an image prompt, mood, characters and camera
+// motion for each segment. The default is xml.
+func Initialize() error {
+	seg, err := New(os.Getenv("SEGMENTER"))
+	if err != nil {
+		return err
+	}
+	Default = seg
+	return nil
+}
+
+// New returns the named segmenter, configured from the environment
+func New(name string) (Segmenter, error) {
+	format := os.Getenv("SEGMENTER_FORMAT")
+	if format != "" && format != FormatXML && format != FormatJSON {
+		return nil, fmt.Errorf("unknown segmenter format %q, expected xml or json", format)
+	}
+
+	switch name {
+	case "", "groq":
+		seg := NewGroq(os.Getenv("GROQ_API_KEY"))
+		seg.Format = format
+		return seg, nil
+	case "openai":
+		baseURL := os.Getenv("SEGMENTER_BASE_URL")
+		if baseURL == "" {
+			return nil, fmt.Errorf("SEGMENTER_BASE_URL must be set for the openai segmenter")
+		}
+		seg := NewOpenAICompatible(baseURL, os.Getenv("SEGMENTER_API_KEY"), os.Getenv("SEGMENTER_MODEL"))
+		seg.Format = format
+		return seg, nil
+	case "rules":
+		return NewRuleBased(), nil
+	default:
+		return nil, fmt.Errorf("unknown segmenter %q", name)
+	}
+}
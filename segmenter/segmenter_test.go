@@ -0,0 +1,94 @@
+package segmenter
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/1rvyn/halloween-story-generator/models"
+)
+
+func TestRuleBasedSplitsParagraphsAndSentences(t *testing.T) {
+	story := `It was a dark and stormy night. Sarah heard a noise in the attic. It got louder. Then it stopped!
+
+She climbed the stairs with Mr. Hale's old flashlight. "Who's there?" she whispered.`
+
+	segments, err := NewRuleBased().Segment(context.Background(), story)
+	if err != nil {
+		t.Fatalf("Expected success, got error: %v", err)
+	}
+
+	expected := []string{
+		"It was a dark and stormy night. Sarah heard a noise in the attic. It got louder.",
+		"Then it stopped!",
+		`She climbed the stairs with Mr. Hale's old flashlight. "Who's there?" she whispered.`,
+	}
+	if len(segments) != len(expected) {
+		t.Fatalf("Expected %d segments, got %d: %+v", len(expected), len(segments), segments)
+	}
+	for i, seg := range segments {
+		if seg.Number != i+1 {
+			t.Errorf("Expected segment %d to be numbered %d, got %d", i, i+1, seg.Number)
+		}
+		if seg.Text != expected[i] {
+			t.Errorf("Segment %d: expected %q, got %q", i+1, expected[i], seg.Text)
+		}
+	}
+}
+
+func TestRuleBasedEmptyStory(t *testing.T) {
+	_, err := NewRuleBased().Segment(context.Background(), "  \n\n ")
+	if err == nil {
+		t.Error("Expected error for empty story, got nil")
+	}
+}
+
+func TestOpenAICompatibleSegment(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/chat/completions" {
+			t.Errorf("Unexpected path %s", r.URL.Path)
+		}
+		if got := r.Header.Get("Authorization"); got != "Bearer test-key" {
+			t.Errorf("Unexpected Authorization header %q", got)
+		}
+
+		var req models.GroqRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("Failed to decode request: %v", err)
+		}
+		if req.Model != "test-model" {
+			t.Errorf("Expected model test-model, got %s", req.Model)
+		}
+
+		json.NewEncoder(w).Encode(chatResponse{
+			Choices: []choice{{Message: models.Message{
+				Role:    "assistant",
+				Content: "<segment number=\"1\">\nFirst part.\n</segment>\n<segment number=\"2\">Second part.</segment>",
+			}}},
+		})
+	}))
+	defer server.Close()
+
+	seg := NewOpenAICompatible(server.URL+"/v1/", "test-key", "test-model")
+	segments, err := seg.Segment(context.Background(), "First part. Second part.")
+	if err != nil {
+		t.Fatalf("Expected success, got error: %v", err)
+	}
+	if len(segments) != 2 || segments[0].Text != "First part." || segments[1].Number != 2 {
+		t.Errorf("Unexpected segments: %+v", segments)
+	}
+}
+
+func TestOpenAICompatibleAPIFailure(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"error":"invalid api key"}`, http.StatusUnauthorized)
+	}))
+	defer server.Close()
+
+	_, err := NewOpenAICompatible(server.URL, "bad-key", "test-model").Segment(context.Background(), "A story.")
+	if err == nil {
+		t.Error("Expected API failure, got nil")
+	}
+}
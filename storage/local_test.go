@@ -0,0 +1,104 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLocalStoreRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	store, err := NewLocalStore(t.TempDir(), "/files/")
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+
+	for _, key := range []string{"videos/story_1_video.mp4", "images/story_1_segment_1.png", "images/story_1_segment_2.png"} {
+		if err := store.Put(ctx, key, strings.NewReader("data for "+key), "application/octet-stream"); err != nil {
+			t.Fatalf("Put %s: %v", key, err)
+		}
+	}
+
+	body, err := store.Get(ctx, "videos/story_1_video.mp4")
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	data, _ := io.ReadAll(body)
+	body.Close()
+	if string(data) != "data for videos/story_1_video.mp4" {
+		t.Errorf("Unexpected contents %q", data)
+	}
+
+	keys, err := store.List(ctx, "images/")
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if expected := []string{"images/story_1_segment_1.png", "images/story_1_segment_2.png"}; !reflect.DeepEqual(keys, expected) {
+		t.Errorf("Expected %v, got %v", expected, keys)
+	}
+
+	if url := store.URL("images/story_1_segment_1.png"); url != "/files/images/story_1_segment_1.png" {
+		t.Errorf("Unexpected URL %s", url)
+	}
+
+	if err := store.Delete(ctx, "videos/story_1_video.mp4"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := store.Get(ctx, "videos/story_1_video.mp4"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound after delete, got %v", err)
+	}
+}
+
+func TestLocalStoreRejectsEscapingKeys(t *testing.T) {
+	store, err := NewLocalStore(t.TempDir(), LocalURLPrefix)
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+
+	for _, key := range []string{"../outside", "images/../../outside", "/absolute", ""} {
+		if err := store.Put(context.Background(), key, strings.NewReader("x"), "text/plain"); err == nil {
+			t.Errorf("Expected Put(%q) to fail", key)
+		}
+	}
+}
+
+func TestLocalStoreSignedURL(t *testing.T) {
+	store, err := NewLocalStore(t.TempDir(), "/files")
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+
+	signed, err := store.SignedURL(context.Background(), "videos/story_1_video.mp4", time.Minute)
+	if err != nil {
+		t.Fatalf("SignedURL: %v", err)
+	}
+	u, err := url.Parse(signed)
+	if err != nil {
+		t.Fatalf("Invalid URL %q: %v", signed, err)
+	}
+	if u.Path != "/files/videos/story_1_video.mp4" {
+		t.Errorf("Unexpected path %q", u.Path)
+	}
+
+	expires, signature := u.Query().Get("expires"), u.Query().Get("signature")
+	if !store.Verify("videos/story_1_video.mp4", expires, signature) {
+		t.Error("Expected signature to verify")
+	}
+	if store.Verify("videos/story_2_video.mp4", expires, signature) {
+		t.Error("Expected signature for another key to be rejected")
+	}
+	if store.Verify("videos/story_1_video.mp4", "1", signature) {
+		t.Error("Expected expired link to be rejected")
+	}
+
+	expired, _ := store.SignedURL(context.Background(), "videos/story_1_video.mp4", -time.Minute)
+	u, _ = url.Parse(expired)
+	if store.Verify("videos/story_1_video.mp4", u.Query().Get("expires"), u.Query().Get("signature")) {
+		t.Error("Expected expired signature to be rejected")
+	}
+}
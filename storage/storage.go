@@ -0,0 +1,71 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// ErrNotFound is returned by Get when there is no object at the key
+var ErrNotFound = errors.New("object not found")
+
+// BlobStore holds the images, audio and videos the pipeline produces.
+// Keys are slash-separated paths such as "videos/story_1_video.mp4".
+type BlobStore interface {
+	Put(ctx context.Context, key string, body io.Reader, contentType string) error
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	Delete(ctx context.Context, key string) error
+	URL(key string) string
+	List(ctx context.Context, prefix string) ([]string, error)
+
+	// SignedURL returns a URL that grants read access to a private object until it expires
+	SignedURL(ctx context.Context, key string, expires time.Duration) (string, error)
+}
+
+// Default is the store the application uses, set up by Initialize
+var Default BlobStore
+
+// URLSigner signs the URLs the app serves itself, set up by Initialize
+var URLSigner *Signer
+
+// Initialize picks the store from the STORAGE_BACKEND environment variable.
+// It should be called during application startup.
+//
+//	s3    (default) Cloudflare R2 or any S3-compatible service
+//	local files under STORAGE_LOCAL_DIR, served by the app at LocalURLPrefix
+//
+// URLs the app signs itself use STORAGE_SIGNING_KEY, or a random key if it
+// isn't set. Set it when running several instances.
+func Initialize() error {
+	signer, err := NewSigner([]byte(os.Getenv("STORAGE_SIGNING_KEY")))
+	if err != nil {
+		return err
+	}
+	URLSigner = signer
+
+	switch backend := os.Getenv("STORAGE_BACKEND"); backend {
+	case "", "s3":
+		store, err := NewS3StoreFromEnv()
+		if err != nil {
+			return err
+		}
+		Default = store
+	case "local":
+		dir := os.Getenv("STORAGE_LOCAL_DIR")
+		if dir == "" {
+			dir = "./data"
+		}
+		store, err := NewLocalStore(dir, LocalURLPrefix)
+		if err != nil {
+			return err
+		}
+		store.Signer = signer
+		Default = store
+	default:
+		return fmt.Errorf("unknown storage backend %q", backend)
+	}
+	return nil
+}